@@ -0,0 +1,168 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=example.com,resources=jsonserverpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// PolicyViolation is returned by the webhook when a JsonServer breaks a rule
+// of a JsonServerPolicy
+type PolicyViolation struct {
+	// Policy is the name of the JsonServerPolicy
+	Policy string
+
+	// Rule is the spec field of the violated rule, e.g. "nameRegex"
+	Rule string
+
+	// Message describes the violation
+	Message string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("JsonServerPolicy %q rule %s: %s", v.Policy, v.Rule, v.Message)
+}
+
+// applicablePolicies returns the JsonServerPolicies selecting the namespace of
+// the JsonServer, sorted by name
+func (r *JsonServer) applicablePolicies(ctx context.Context, reader client.Reader) ([]JsonServerPolicy, error) {
+	if reader == nil {
+		return nil, nil
+	}
+
+	list := &JsonServerPolicyList{}
+	if err := reader.List(ctx, list); err != nil {
+		return nil, err
+	}
+
+	var namespace *corev1.Namespace
+	var policies []JsonServerPolicy
+	for _, policy := range list.Items {
+		selector := policy.Spec.NamespaceSelector
+		if selector != nil && (len(selector.MatchLabels) > 0 || len(selector.MatchExpressions) > 0) {
+			// Only read the namespace when a policy selects by label
+			if namespace == nil {
+				namespace = &corev1.Namespace{}
+				if err := reader.Get(ctx, client.ObjectKey{Name: r.Namespace}, namespace); err != nil {
+					return nil, err
+				}
+			}
+			s, err := metav1.LabelSelectorAsSelector(selector)
+			if err != nil {
+				return nil, fmt.Errorf("JsonServerPolicy %q has an invalid namespaceSelector: %w", policy.Name, err)
+			}
+			if !s.Matches(labels.Set(namespace.Labels)) {
+				continue
+			}
+		}
+		policies = append(policies, policy)
+	}
+
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, nil
+}
+
+// checkPolicies returns every rule of the policies the JsonServer violates
+func (r *JsonServer) checkPolicies(policies []JsonServerPolicy) error {
+	var violations []error
+	for i := range policies {
+		violations = append(violations, r.checkPolicy(&policies[i])...)
+	}
+	return errors.Join(violations...)
+}
+
+// checkPolicy returns the rules of a single policy the JsonServer violates
+func (r *JsonServer) checkPolicy(policy *JsonServerPolicy) []error {
+	var violations []error
+	violate := func(rule, format string, args ...interface{}) {
+		violations = append(violations, &PolicyViolation{Policy: policy.Name, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	spec := policy.Spec
+
+	if spec.NameRegex != "" {
+		re, err := regexp.Compile(spec.NameRegex)
+		switch {
+		case err != nil:
+			violate("nameRegex", "invalid regular expression %q: %v", spec.NameRegex, err)
+		case !re.MatchString(r.Name):
+			violate("nameRegex", "metadata.name %q does not match %q", r.Name, spec.NameRegex)
+		}
+	}
+
+	if spec.MaxReplicas != nil && r.Spec.Replicas > *spec.MaxReplicas {
+		violate("maxReplicas", "spec.replicas %d exceeds the maximum of %d", r.Spec.Replicas, *spec.MaxReplicas)
+	}
+
+	if spec.MaxConfigSize != nil && int64(len(r.Spec.JsonConfig)) > spec.MaxConfigSize.Value() {
+		violate("maxConfigSize", "spec.jsonConfig is %d bytes, the maximum is %s", len(r.Spec.JsonConfig), spec.MaxConfigSize.String())
+	}
+
+	if len(spec.AllowedImages) > 0 && r.Spec.Image != "" && !imageAllowed(r.Spec.Image, spec.AllowedImages) {
+		violate("allowedImages", "spec.image %q is not one of %s", r.Spec.Image, strings.Join(spec.AllowedImages, ", "))
+	}
+
+	for _, key := range spec.RequiredLabels {
+		if _, ok := r.Labels[key]; !ok {
+			violate("requiredLabels", "label %q is required", key)
+		}
+	}
+
+	for _, key := range spec.RequiredAnnotations {
+		if _, ok := r.Annotations[key]; !ok {
+			violate("requiredAnnotations", "annotation %q is required", key)
+		}
+	}
+
+	return violations
+}
+
+// imageAllowed reports whether the image matches one of the allowed images
+func imageAllowed(image string, allowed []string) bool {
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok {
+			if strings.HasPrefix(image, prefix) {
+				return true
+			}
+		} else if image == a {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNameRegex reports whether one of the policies replaces the default name prefix rule
+func hasNameRegex(policies []JsonServerPolicy) bool {
+	for _, policy := range policies {
+		if policy.Spec.NameRegex != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -17,6 +17,12 @@ limitations under the License.
 package v1
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -24,19 +30,445 @@ import (
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // JsonServerSpec defines the desired state of JsonServer
+// +kubebuilder:validation:XValidation:rule="[has(self.jsonConfig) && size(self.jsonConfig) > 0, has(self.source) && has(self.source.configMapKeyRef), has(self.source) && has(self.source.secretKeyRef), has(self.restoreFrom)].exists_one(x, x)",message="exactly one of spec.jsonConfig, spec.source.configMapKeyRef, spec.source.secretKeyRef and spec.restoreFrom must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.rollbackTo) || !has(self.source)",message="spec.rollbackTo is not supported together with spec.source, roll back the referenced object instead"
+// +kubebuilder:validation:XValidation:rule="!has(self.idle) || !has(self.service) || !has(self.service.type) || self.service.type != 'Headless'",message="spec.idle is not supported with spec.service.type Headless"
+// +kubebuilder:validation:XValidation:rule="!(has(self.storage) && has(self.storage.mode) && self.storage.mode == 'Persistent') || self.replicas == 1",message="spec.storage.mode Persistent requires spec.replicas 1, the ReadWriteOnce volume cannot be shared between replicas"
 type JsonServerSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// Replicas is the number of json-server instances to run
-	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:XValidation:rule="self >= 1",message="spec.replicas must be at least 1, set spec.suspend to scale to zero"
 	// +kubebuilder:default=1
 	Replicas int32 `json:"replicas,omitempty"`
 
+	// Suspend scales the json-server Deployment to zero while keeping its
+	// data, Service and exposure. Set it back to false to resume
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Idle scales the json-server Deployment to zero after a period without
+	// HTTP traffic. Requests are then held by the activator in the controller
+	// manager until a pod is ready again
+	// +optional
+	Idle *IdleSpec `json:"idle,omitempty"`
+
 	// JsonConfig is the JSON configuration for the json-server
-	// This will be mounted as /data/db.json in the container
-	// +kubebuilder:validation:Required
-	JsonConfig string `json:"jsonConfig"`
+	// This will be mounted as /data/db.json in the container.
+	// Exactly one of jsonConfig, source and restoreFrom must be set
+	// +optional
+	JsonConfig string `json:"jsonConfig,omitempty"`
+
+	// Source loads the JSON configuration from an existing ConfigMap or Secret
+	// instead of jsonConfig
+	// +optional
+	Source *ConfigSource `json:"source,omitempty"`
+
+	// RestoreFrom seeds the json-server with the data captured by a
+	// JsonServerSnapshot instead of jsonConfig
+	// +optional
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+
+	// Storage configures where json-server keeps its data
+	// +optional
+	Storage *StorageSpec `json:"storage,omitempty"`
+
+	// Runtime selects the server implementation. "node" runs the json-server
+	// image, "go" runs the built-in implementation of the controller image,
+	// which starts in milliseconds and needs far less memory
+	// +kubebuilder:default=node
+	// +optional
+	Runtime Runtime `json:"runtime,omitempty"`
+
+	// Image is the json-server container image.
+	// Defaults to the controller-wide image set with --default-image, or
+	// --go-runtime-image for the go runtime
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ImagePullPolicy is the pull policy of the json-server container
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// ImagePullSecrets are references to secrets used to pull the image
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// PodTemplate holds overrides merged into the pod template of the generated Deployment
+	// +optional
+	PodTemplate *PodTemplateOverrides `json:"podTemplate,omitempty"`
+
+	// ReloadStrategy controls how running pods pick up jsonConfig changes.
+	// "Restart" rolls the Deployment whenever the data changes, "InPlace"
+	// keeps the pods and lets json-server watch db.json for changes. With
+	// InPlace the pods mount the <name>-config ConfigMap, which is updated in
+	// place next to the immutable revisions
+	// +kubebuilder:default=Restart
+	// +optional
+	ReloadStrategy ReloadStrategy `json:"reloadStrategy,omitempty"`
+
+	// Probes overrides the default probes of the json-server container
+	// +optional
+	Probes *ProbesSpec `json:"probes,omitempty"`
+
+	// Service configures the Service exposing json-server
+	// +optional
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// Expose makes json-server reachable from outside the cluster through
+	// an Ingress or a Gateway API HTTPRoute
+	// +optional
+	Expose *ExposeSpec `json:"expose,omitempty"`
+
+	// Routes are json-server rewrite rules written to routes.json, e.g.
+	// "/api/v2/*": "/$1". In a rule "*" matches anything, ":name" one path
+	// segment and a backslash escapes the next character; the target refers to
+	// the matches as $1, $2, ... in order, or by :name. Rules are applied in the
+	// order of their keys.
+	// +optional
+	Routes map[string]string `json:"routes,omitempty"`
+
+	// RevisionHistoryLimit is the number of old data revisions kept for rollback
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=10
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// RollbackTo pins the served data to an earlier revision, given by its
+	// hash from status.revisions. Remove it to serve jsonConfig again.
+	// Only supported for inline jsonConfig
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{16}$`
+	// +optional
+	RollbackTo string `json:"rollbackTo,omitempty"`
+
+	// ResetSchedule is a cron expression, e.g. "0 6 * * *", at which the data
+	// is reset to its source, as if the example.com/reset-requested-at annotation
+	// was changed. Times are UTC unless prefixed with "CRON_TZ=<zone> "
+	// +optional
+	ResetSchedule string `json:"resetSchedule,omitempty"`
+
+	// TTLSecondsAfterCreation deletes the JsonServer this many seconds after it was created
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterCreation *int64 `json:"ttlSecondsAfterCreation,omitempty"`
+
+	// ExpiresAt deletes the JsonServer at the given time. When both this and
+	// ttlSecondsAfterCreation are set, the earlier time applies
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// ExpirationTime returns the time the JsonServer is deleted at, from
+// spec.ttlSecondsAfterCreation and spec.expiresAt. The TTL counts from
+// created, which is the creation timestamp once the object exists.
+func (r *JsonServer) ExpirationTime(created time.Time) (time.Time, bool) {
+	var expiry time.Time
+	if ttl := r.Spec.TTLSecondsAfterCreation; ttl != nil {
+		expiry = created.Add(time.Duration(*ttl) * time.Second)
+	}
+	if at := r.Spec.ExpiresAt; at != nil && (expiry.IsZero() || at.Time.Before(expiry)) {
+		expiry = at.Time
+	}
+	return expiry, !expiry.IsZero()
+}
+
+// ExposeType selects the kind of object used to expose json-server
+// +kubebuilder:validation:Enum=Ingress;HTTPRoute
+type ExposeType string
+
+const (
+	// ExposeTypeIngress creates a networking.k8s.io/v1 Ingress
+	ExposeTypeIngress ExposeType = "Ingress"
+
+	// ExposeTypeHTTPRoute creates a gateway.networking.k8s.io/v1 HTTPRoute
+	ExposeTypeHTTPRoute ExposeType = "HTTPRoute"
+)
+
+// ExposeSpec defines how json-server is exposed outside the cluster
+// +kubebuilder:validation:XValidation:rule="self.type != 'HTTPRoute' || (has(self.parentRefs) && size(self.parentRefs) > 0)",message="spec.expose.parentRefs is required with spec.expose.type HTTPRoute"
+// +kubebuilder:validation:XValidation:rule="self.type != 'HTTPRoute' || !has(self.tlsSecretName)",message="spec.expose.tlsSecretName is only supported with spec.expose.type Ingress, configure TLS on the Gateway listener instead"
+type ExposeSpec struct {
+	// Type is either "Ingress" or "HTTPRoute"
+	Type ExposeType `json:"type"`
+
+	// Host is the external host name. The placeholders {{name}} and
+	// {{namespace}} are replaced with the JsonServer name and namespace,
+	// e.g. "{{name}}.{{namespace}}.mocks.example.internal"
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// PathPrefix is the path prefix routed to json-server
+	// +kubebuilder:validation:Pattern=`^/`
+	// +kubebuilder:default="/"
+	// +optional
+	PathPrefix string `json:"pathPrefix,omitempty"`
+
+	// TLSSecretName is the secret holding the certificate for Host.
+	// Only supported with the Ingress type, HTTPRoutes use the TLS settings of their Gateway
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// IngressClassName is the class of the Ingress
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// ParentRefs are the Gateways the HTTPRoute attaches to. Required with the HTTPRoute type
+	// +optional
+	ParentRefs []GatewayParentRef `json:"parentRefs,omitempty"`
+
+	// Annotations added to the Ingress or HTTPRoute
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// GatewayParentRef references a Gateway an HTTPRoute attaches to
+type GatewayParentRef struct {
+	// Name of the Gateway
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the Gateway, defaults to the JsonServer namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName is the listener of the Gateway to attach to
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// RenderHost returns Host with the {{name}} and {{namespace}} placeholders replaced
+func (e *ExposeSpec) RenderHost(name, namespace string) string {
+	return strings.NewReplacer("{{name}}", name, "{{namespace}}", namespace).Replace(e.Host)
+}
+
+// URL returns the external URL of the exposed json-server
+func (e *ExposeSpec) URL(name, namespace string) string {
+	scheme := "http"
+	if e.TLSSecretName != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, e.RenderHost(name, namespace), e.PathPrefix)
+}
+
+// ServiceType is the kind of Service created for the JsonServer
+// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer;Headless
+type ServiceType string
+
+const (
+	ServiceTypeClusterIP    ServiceType = "ClusterIP"
+	ServiceTypeNodePort     ServiceType = "NodePort"
+	ServiceTypeLoadBalancer ServiceType = "LoadBalancer"
+
+	// ServiceTypeHeadless creates a ClusterIP Service without a cluster IP
+	ServiceTypeHeadless ServiceType = "Headless"
+)
+
+// ServiceSpec defines the Service exposing json-server
+// +kubebuilder:validation:XValidation:rule="!has(self.nodePort) || (has(self.type) && self.type in ['NodePort', 'LoadBalancer'])",message="spec.service.nodePort requires spec.service.type NodePort or LoadBalancer"
+// +kubebuilder:validation:XValidation:rule="!has(self.externalTrafficPolicy) || (has(self.type) && self.type in ['NodePort', 'LoadBalancer'])",message="spec.service.externalTrafficPolicy requires spec.service.type NodePort or LoadBalancer"
+type ServiceSpec struct {
+	// Type of the Service
+	// +kubebuilder:default=ClusterIP
+	// +optional
+	Type ServiceType `json:"type,omitempty"`
+
+	// Port of the Service. json-server listens on the same port
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=3000
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// NodePort to use with the NodePort and LoadBalancer types.
+	// Allocated by the cluster when empty
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+
+	// Annotations added to the Service
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ExternalTrafficPolicy of the NodePort and LoadBalancer types
+	// +optional
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicy `json:"externalTrafficPolicy,omitempty"`
+
+	// SessionAffinity of the Service
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// +optional
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+}
+
+// ProbesSpec defines the probes of the json-server container.
+// Probes left empty default to an HTTP GET on the first top-level
+// collection of jsonConfig. Fields left empty in a probe keep their
+// default, e.g. setting only periodSeconds keeps the default handler.
+type ProbesSpec struct {
+	// Liveness probe of the json-server container
+	// +optional
+	Liveness *corev1.Probe `json:"liveness,omitempty"`
+
+	// Readiness probe of the json-server container
+	// +optional
+	Readiness *corev1.Probe `json:"readiness,omitempty"`
+
+	// Startup probe of the json-server container
+	// +optional
+	Startup *corev1.Probe `json:"startup,omitempty"`
+}
+
+// Runtime selects the server implementation of a JsonServer
+// +kubebuilder:validation:Enum=node;go
+type Runtime string
+
+const (
+	// RuntimeNode runs the Node.js json-server image
+	RuntimeNode Runtime = "node"
+
+	// RuntimeGo runs "manager serve", the Go implementation of the
+	// json-server REST API built into the controller image
+	RuntimeGo Runtime = "go"
+)
+
+// ReloadStrategy selects how data changes reach running pods
+// +kubebuilder:validation:Enum=Restart;InPlace
+type ReloadStrategy string
+
+const (
+	// ReloadStrategyRestart triggers a rolling restart when the data changes
+	ReloadStrategyRestart ReloadStrategy = "Restart"
+
+	// ReloadStrategyInPlace runs json-server with --watch and relies on the
+	// kubelet refreshing the mounted ConfigMap
+	ReloadStrategyInPlace ReloadStrategy = "InPlace"
+)
+
+// PodTemplateOverrides defines the pod settings users can change on the generated Deployment.
+// Unset fields keep the controller defaults.
+type PodTemplateOverrides struct {
+	// Labels are added to the pods. The "app" selector label cannot be overridden
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the pods
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Resources of the json-server container.
+	// Defaults to small requests and a memory limit
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector constrains the nodes the pods can run on
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the pods
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity scheduling rules of the pods
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// TopologySpreadConstraints of the pods
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// PriorityClassName of the pods
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// SecurityContext of the json-server container.
+	// Defaults to a context compatible with the restricted Pod Security Standard
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// PodSecurityContext of the pods.
+	// Defaults to a context compatible with the restricted Pod Security Standard
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+}
+
+// ResetRequestedAtAnnotation requests a data reset whenever its value changes,
+// e.g. kubectl annotate jsonserver app-x example.com/reset-requested-at="$(date -u +%FT%TZ)" --overwrite
+const ResetRequestedAtAnnotation = "example.com/reset-requested-at"
+
+// LastRequestAtAnnotation is set by the activator to the time of the last
+// request to a JsonServer with spec.idle
+const LastRequestAtAnnotation = "example.com/last-request-at"
+
+// ConfigCompressionThreshold is the size in bytes above which an inline
+// jsonConfig is stored gzip-compressed, and split across several ConfigMaps
+// when it is still too large for one
+const ConfigCompressionThreshold = 768 * 1024
+
+// ConfigSource references the key of an existing object holding db.json.
+// Exactly one of its fields must be set.
+// +kubebuilder:validation:XValidation:rule="!has(self.configMapKeyRef) || (has(self.configMapKeyRef.name) && size(self.configMapKeyRef.name) > 0 && size(self.configMapKeyRef.key) > 0)",message="spec.source.configMapKeyRef requires name and key"
+// +kubebuilder:validation:XValidation:rule="!has(self.secretKeyRef) || (has(self.secretKeyRef.name) && size(self.secretKeyRef.name) > 0 && size(self.secretKeyRef.key) > 0)",message="spec.source.secretKeyRef requires name and key"
+type ConfigSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap in the JsonServer namespace
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a key of a Secret in the JsonServer namespace
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// IdleSpec configures scaling to zero when json-server receives no requests
+type IdleSpec struct {
+	// AfterMinutes is the time without requests after which json-server is scaled to zero
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=30
+	// +optional
+	AfterMinutes int32 `json:"afterMinutes,omitempty"`
+}
+
+// RestoreSource references a JsonServerSnapshot holding db.json
+type RestoreSource struct {
+	// SnapshotName is a completed JsonServerSnapshot in the JsonServer namespace
+	// +kubebuilder:validation:MinLength=1
+	SnapshotName string `json:"snapshotName"`
+}
+
+// StorageMode selects how the json-server data directory is backed
+// +kubebuilder:validation:Enum=Ephemeral;Persistent
+type StorageMode string
+
+const (
+	// StorageModeEphemeral mounts the generated ConfigMap directly at /data.
+	// Changes made through the REST API are not kept.
+	StorageModeEphemeral StorageMode = "Ephemeral"
+
+	// StorageModePersistent mounts a writable PersistentVolumeClaim at /data.
+	// The volume is seeded once from jsonConfig and survives pod restarts.
+	// It runs a single replica and replaces pods instead of rolling them.
+	StorageModePersistent StorageMode = "Persistent"
+)
+
+// StorageSpec defines the storage backing the json-server data
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'Persistent' || !has(self.size) || quantity(string(self.size)).isGreaterThan(quantity('0'))",message="spec.storage.size must be greater than zero"
+// +kubebuilder:validation:XValidation:rule="has(self.storageClassName) == has(oldSelf.storageClassName) && (!has(self.storageClassName) || self.storageClassName == oldSelf.storageClassName)",message="spec.storage.storageClassName is immutable"
+type StorageSpec struct {
+	// Mode is either "Ephemeral" or "Persistent"
+	// +kubebuilder:default=Ephemeral
+	// +optional
+	Mode StorageMode `json:"mode,omitempty"`
+
+	// Size is the requested size of the PersistentVolumeClaim.
+	// Only used in Persistent mode, defaults to 1Gi
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName is the storage class of the PersistentVolumeClaim.
+	// Only used in Persistent mode, the cluster default is used when empty
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
 }
 
 // JsonServerStatus defines the observed state of JsonServer
@@ -45,23 +477,201 @@ type JsonServerStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// State indicates the current state of the JsonServer
-	// Can be "Synced" or "Error"
-	// +kubebuilder:validation:Enum=Synced;Error
+	// Can be "Synced", "Progressing", "Suspended", "Idle" or "Error"
+	// +kubebuilder:validation:Enum=Synced;Progressing;Suspended;Idle;Error
 	State string `json:"state,omitempty"`
 
 	// Message provides additional information about the current state
 	Message string `json:"message,omitempty"`
 
-	// Replicas is the current number of replicas
+	// Reason is a machine-readable reason for the Error state. Failed API
+	// calls report Conflict, Forbidden, QuotaExceeded, Invalid or Transient;
+	// other errors report the reason of the failing condition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Replicas is the current number of pods of the owned Deployment
 	// +optional
 	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of pods passing their readiness checks
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// AvailableReplicas is the number of pods that have been ready for at least minReadySeconds
+	// +optional
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+
+	// UpdatedReplicas is the number of pods running the latest pod template
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+
+	// InternalURL is the in-cluster URL of the json-server Service
+	// +optional
+	InternalURL string `json:"internalURL,omitempty"`
+
+	// Resources summarizes the top-level resources served by json-server
+	// +optional
+	Resources []ResourceSummary `json:"resources,omitempty"`
+
+	// ExternalURL is the URL json-server is exposed on through spec.expose
+	// +optional
+	ExternalURL string `json:"externalURL,omitempty"`
+
+	// ConfigHash is the hash of the data revision currently served
+	// +optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Revisions lists the data revisions kept for rollback, newest first
+	// +optional
+	Revisions []ConfigRevision `json:"revisions,omitempty"`
+
+	// LastResetTime is when the data was last reset on request or on schedule
+	// +optional
+	LastResetTime *metav1.Time `json:"lastResetTime,omitempty"`
+
+	// IdleSince is set while json-server is scaled to zero by spec.idle
+	// +optional
+	IdleSince *metav1.Time `json:"idleSince,omitempty"`
+
+	// ExpirationTime is when the JsonServer is deleted by
+	// spec.ttlSecondsAfterCreation or spec.expiresAt
+	// +optional
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+
+	// RemainingLifetime is the time left until ExpirationTime, e.g. "3h12m",
+	// as of the last reconcile
+	// +optional
+	RemainingLifetime string `json:"remainingLifetime,omitempty"`
+
+	// ObservedResetRequest is the last handled value of the
+	// example.com/reset-requested-at annotation
+	// +optional
+	ObservedResetRequest string `json:"observedResetRequest,omitempty"`
+
+	// ObservedGeneration is the most recent generation observed by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the JsonServer state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
+// ConfigRevision is an immutable version of the json-server data
+type ConfigRevision struct {
+	// Revision is the sequence number of the revision, higher is newer
+	Revision int64 `json:"revision"`
+
+	// Hash identifies the revision and can be used in spec.rollbackTo
+	Hash string `json:"hash"`
+
+	// ConfigMapName is the ConfigMap holding the revision
+	ConfigMapName string `json:"configMapName"`
+}
+
+// ResourceKind is the JSON type of a top-level resource
+// +kubebuilder:validation:Enum=array;object
+type ResourceKind string
+
+const (
+	// ResourceKindArray is a plural resource, e.g. /posts and /posts/1
+	ResourceKindArray ResourceKind = "array"
+
+	// ResourceKindObject is a singular resource, e.g. /profile
+	ResourceKindObject ResourceKind = "object"
+)
+
+// ResourceSummary describes a top-level resource of jsonConfig
+type ResourceSummary struct {
+	// Name of the resource, which is also its route
+	Name string `json:"name"`
+
+	// Kind is "array" or "object"
+	Kind ResourceKind `json:"kind"`
+
+	// Count is the number of items of an array or keys of an object
+	Count int32 `json:"count"`
+}
+
+// Condition types reported on JsonServer
+const (
+	// ConditionConfigValid is True when the data parses as JSON
+	ConditionConfigValid = "ConfigValid"
+
+	// ConditionConfigMapReady is True when the data ConfigMap is up to date
+	ConditionConfigMapReady = "ConfigMapReady"
+
+	// ConditionStorageReady is True when the PersistentVolumeClaim exists (Persistent mode only)
+	ConditionStorageReady = "StorageReady"
+
+	// ConditionDeploymentAvailable is True when the Deployment finished rolling out
+	ConditionDeploymentAvailable = "DeploymentAvailable"
+
+	// ConditionServiceReady is True when the Service is up to date
+	ConditionServiceReady = "ServiceReady"
+
+	// ConditionExposed is True when the Ingress or HTTPRoute is up to date (spec.expose only)
+	ConditionExposed = "Exposed"
+
+	// ConditionReady is True when the JsonServer is serving its current spec
+	ConditionReady = "Ready"
+)
+
+// Condition reasons reported on JsonServer
+const (
+	ReasonValidJSON            = "ValidJSON"
+	ReasonInvalidJSON          = "InvalidJSON"
+	ReasonSourceNotFound       = "SourceNotFound"
+	ReasonSnapshotNotReady     = "SnapshotNotReady"
+	ReasonReconciled           = "Reconciled"
+	ReasonReconcileFailed      = "ReconcileFailed"
+	ReasonRolloutComplete      = "RolloutComplete"
+	ReasonRolloutInProgress    = "RolloutInProgress"
+	ReasonRolledBack           = "RolledBack"
+	ReasonRevisionNotFound     = "RevisionNotFound"
+	ReasonInvalidSchedule      = "InvalidSchedule"
+	ReasonSuspended            = "Suspended"
+	ReasonIdle                 = "Idle"
+	ReasonActivatorDisabled    = "ActivatorDisabled"
+	ReasonGoRuntimeUnavailable = "GoRuntimeUnavailable"
+)
+
+// Failure reasons reported in status.reason when an API call fails
+const (
+	// FailureReasonConflict is reported for write conflicts, retried with backoff
+	FailureReasonConflict = "Conflict"
+
+	// FailureReasonForbidden is reported when RBAC or an admission webhook denies the request
+	FailureReasonForbidden = "Forbidden"
+
+	// FailureReasonQuotaExceeded is reported when a ResourceQuota denies the request
+	FailureReasonQuotaExceeded = "QuotaExceeded"
+
+	// FailureReasonInvalid is reported when the API server rejects an owned object
+	FailureReasonInvalid = "Invalid"
+
+	// FailureReasonTransient is reported for timeouts, throttling and
+	// unavailable API servers, retried with backoff
+	FailureReasonTransient = "Transient"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas
 // +kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.status.internalURL`,priority=1
+// +kubebuilder:printcolumn:name="Resources",type=string,JSONPath=`.status.resources[*].name`,priority=1
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.externalURL`,priority=1
+// +kubebuilder:printcolumn:name="Last Reset",type="date",JSONPath=`.status.lastResetTime`,priority=1
+// +kubebuilder:printcolumn:name="Expires In",type=string,JSONPath=`.status.remainingLifetime`
 // +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`,priority=1
 // +kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
@@ -0,0 +1,304 @@
+package v1
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
+	"k8s.io/apiextensions-apiserver/pkg/registry/customresource/tableconvertor"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+// loadCRD reads a generated CRD from config/crd/bases
+func loadCRD(t *testing.T, crdFile string) *apiextensionsv1.CustomResourceDefinition {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "..", "config", "crd", "bases", crdFile))
+	if err != nil {
+		t.Fatalf("failed to read CRD: %v", err)
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(data, crd); err != nil {
+		t.Fatalf("failed to parse CRD: %v", err)
+	}
+	return crd
+}
+
+// validateCEL evaluates the x-kubernetes-validations of the generated CRD
+// against obj the way the API server does, with old as oldSelf for
+// transition rules. It returns the joined error messages.
+func validateCEL(t *testing.T, crdFile string, obj, old runtime.Object) string {
+	t.Helper()
+
+	crd := loadCRD(t, crdFile)
+	internal := &apiextensions.JSONSchemaProps{}
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(crd.Spec.Versions[0].Schema.OpenAPIV3Schema, internal, nil); err != nil {
+		t.Fatalf("failed to convert schema: %v", err)
+	}
+	schema, err := structuralschema.NewStructural(internal)
+	if err != nil {
+		t.Fatalf("failed to build structural schema: %v", err)
+	}
+
+	toUnstructured := func(o runtime.Object) interface{} {
+		if o == nil {
+			return nil
+		}
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			t.Fatalf("failed to convert object: %v", err)
+		}
+		defaulting.Default(u, schema)
+		return u
+	}
+
+	validator := cel.NewValidator(schema, true, celconfig.PerCallLimit)
+	errs, _ := validator.Validate(context.Background(), nil, schema, toUnstructured(obj), toUnstructured(old), celconfig.RuntimeCELCostBudget)
+	if len(errs) == 0 {
+		return ""
+	}
+	return errs.ToAggregate().Error()
+}
+
+func TestCEL_Replicas(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected one replica to pass: %s", msg)
+	}
+
+	js.Spec.Replicas = -1
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "spec.replicas must be at least 1") {
+		t.Errorf("expected negative replicas to fail, got %q", msg)
+	}
+}
+
+func TestCEL_SourceExactlyOne(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.Source = &ConfigSource{
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "fixtures"},
+			Key:                  "db.json",
+		},
+	}
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected configMapKeyRef alone to pass: %s", msg)
+	}
+
+	js.Spec.JsonConfig = `{"users": []}`
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "exactly one of") {
+		t.Errorf("expected jsonConfig together with a source to fail, got %q", msg)
+	}
+
+	js.Spec.JsonConfig = ""
+	js.Spec.Source = nil
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "exactly one of") {
+		t.Errorf("expected missing data source to fail, got %q", msg)
+	}
+
+	js.Spec.RestoreFrom = &RestoreSource{SnapshotName: "app-test-snapshot"}
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected restoreFrom alone to pass: %s", msg)
+	}
+
+	js.Spec.JsonConfig = `{"users": []}`
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "exactly one of") {
+		t.Errorf("expected restoreFrom together with jsonConfig to fail, got %q", msg)
+	}
+}
+
+func TestCEL_SourceRequiresNameAndKey(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.Source = &ConfigSource{
+		SecretKeyRef: &corev1.SecretKeySelector{Key: "db.json"},
+	}
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "secretKeyRef requires name and key") {
+		t.Errorf("expected secretKeyRef without name to fail, got %q", msg)
+	}
+}
+
+func TestCEL_RollbackToRequiresInlineConfig(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.RollbackTo = "0123456789abcdef"
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected rollbackTo with inline jsonConfig to pass: %s", msg)
+	}
+
+	js.Spec.JsonConfig = ""
+	js.Spec.Source = &ConfigSource{
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "fixtures"},
+			Key:                  "db.json",
+		},
+	}
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "spec.rollbackTo is not supported together with spec.source") {
+		t.Errorf("expected rollbackTo together with a source to fail, got %q", msg)
+	}
+}
+
+func TestCEL_ServiceNodePortRequiresExternalType(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.Service = &ServiceSpec{NodePort: 30080}
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "nodePort requires") {
+		t.Errorf("expected nodePort on a ClusterIP service to fail, got %q", msg)
+	}
+
+	js.Spec.Service.Type = ServiceTypeNodePort
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected nodePort on a NodePort service to pass: %s", msg)
+	}
+}
+
+func TestCEL_IdleNotHeadless(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.Idle = &IdleSpec{AfterMinutes: 15}
+	js.Spec.Service = &ServiceSpec{}
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected idle with a ClusterIP Service to pass: %s", msg)
+	}
+
+	js.Spec.Service.Type = ServiceTypeHeadless
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "spec.idle is not supported") {
+		t.Errorf("expected idle with a headless Service to fail, got %q", msg)
+	}
+}
+
+func TestCEL_ExposeHTTPRouteRequiresParentRefs(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.Expose = &ExposeSpec{Type: ExposeTypeHTTPRoute, Host: "{{name}}.{{namespace}}.mocks.example.internal"}
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "parentRefs is required") {
+		t.Errorf("expected HTTPRoute without parentRefs to fail, got %q", msg)
+	}
+
+	js.Spec.Expose.ParentRefs = []GatewayParentRef{{Name: "mocks"}}
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected HTTPRoute with parentRefs to pass: %s", msg)
+	}
+}
+
+func TestCEL_Storage(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.Storage = &StorageSpec{Mode: StorageModePersistent, Size: resource.NewQuantity(0, resource.BinarySI)}
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "size must be greater than zero") {
+		t.Errorf("expected an empty volume to fail, got %q", msg)
+	}
+
+	// The storage class of the claim cannot change
+	js.Spec.Storage.Size = nil
+	old := js.DeepCopy()
+	old.Spec.Storage.StorageClassName = ptr.To("standard")
+	js.Spec.Storage.StorageClassName = ptr.To("fast")
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, old); !strings.Contains(msg, "storageClassName is immutable") {
+		t.Errorf("expected storageClassName change to fail, got %q", msg)
+	}
+}
+
+func TestCEL_SnapshotSpecImmutable(t *testing.T) {
+	snapshot := &JsonServerSnapshot{}
+	snapshot.Name = "app-test-snapshot"
+	snapshot.Spec.JsonServerName = "app-test"
+
+	old := snapshot.DeepCopy()
+	snapshot.Spec.JsonServerName = "app-other"
+	if msg := validateCEL(t, "example.com_jsonserversnapshots.yaml", snapshot, old); !strings.Contains(msg, "spec is immutable") {
+		t.Errorf("expected snapshot spec change to fail, got %q", msg)
+	}
+}
+
+func TestCEL_PersistentSingleReplica(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.Storage = &StorageSpec{Mode: StorageModePersistent}
+
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected a single persistent replica to pass: %s", msg)
+	}
+
+	js.Spec.Replicas = 2
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); !strings.Contains(msg, "spec.storage.mode Persistent requires spec.replicas 1") {
+		t.Errorf("expected multiple persistent replicas to fail, got %q", msg)
+	}
+
+	js.Spec.Storage.Mode = StorageModeEphemeral
+	if msg := validateCEL(t, "example.com_jsonservers.yaml", js, nil); msg != "" {
+		t.Errorf("expected multiple ephemeral replicas to pass: %s", msg)
+	}
+}
+
+func TestPrinterColumns_ExpiresIn(t *testing.T) {
+	crd := loadCRD(t, "example.com_jsonservers.yaml")
+	convertor, err := tableconvertor.New(crd.Spec.Versions[0].AdditionalPrinterColumns)
+	if err != nil {
+		t.Fatalf("failed to build table convertor: %v", err)
+	}
+
+	// The table is rendered the way kubectl get shows it, for an expiry in the future
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Status.ExpirationTime = &metav1.Time{Time: time.Now().Add(2 * time.Hour)}
+	js.Status.RemainingLifetime = "119m"
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(js)
+	if err != nil {
+		t.Fatalf("failed to convert object: %v", err)
+	}
+	table, err := convertor.ConvertToTable(context.Background(), &unstructured.Unstructured{Object: u}, nil)
+	if err != nil {
+		t.Fatalf("failed to convert to table: %v", err)
+	}
+
+	for i, column := range table.ColumnDefinitions {
+		if column.Name == "Expires In" {
+			if cell := table.Rows[0].Cells[i]; cell != "119m" {
+				t.Errorf("expected Expires In 119m, got %v", cell)
+			}
+			return
+		}
+	}
+	t.Error("expected an Expires In column")
+}
@@ -17,24 +17,44 @@ limitations under the License.
 package v1
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/robfig/cron/v3"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// objectSizeWarningThreshold is the jsonConfig size in bytes that brings a JsonServer
+// close to the 1.5MiB etcd object limit
+const objectSizeWarningThreshold = 1280 * 1024
+
+// MaxTTL caps the lifetime set by spec.ttlSecondsAfterCreation and
+// spec.expiresAt, zero allows any lifetime. It is set from the --max-ttl flag.
+var MaxTTL time.Duration
+
 // log is for logging in this package.
 var jsonserverlog = logf.Log.WithName("jsonserver-resource")
 
 // SetupWebhookWithManager will setup the manager to manage the webhooks
 func (r *JsonServer) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if err := registerWebhookMetrics(); err != nil {
+		return err
+	}
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithValidator(&JsonServerValidator{Reader: mgr.GetClient()}).
 		Complete()
 }
 
@@ -54,60 +74,187 @@ func (r *JsonServer) Default() {
 
 // +kubebuilder:webhook:path=/validate-example-com-v1-jsonserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=example.com,resources=jsonservers,verbs=create;update,versions=v1,name=vjsonserver.kb.io,admissionReviewVersions=v1
 
-var _ webhook.Validator = &JsonServer{}
+// JsonServerValidator validates JsonServers against the rules CEL cannot
+// express and the JsonServerPolicies selecting their namespace
+type JsonServerValidator struct {
+	// Reader reads JsonServerPolicies and Namespaces. Without it no policies are evaluated
+	Reader client.Reader
+}
+
+var _ webhook.CustomValidator = &JsonServerValidator{}
 
-// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
-func (r *JsonServer) ValidateCreate() (admission.Warnings, error) {
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *JsonServerValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	r, ok := obj.(*JsonServer)
+	if !ok {
+		return nil, fmt.Errorf("expected a JsonServer, got %T", obj)
+	}
 	jsonserverlog.Info("validate create", "name", r.Name)
 
-	return r.validateJsonServer()
+	warnings, err := v.validateJsonServer(ctx, r)
+	recordAdmission("create", err)
+	return warnings, err
 }
 
-// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
-func (r *JsonServer) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *JsonServerValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	r, ok := newObj.(*JsonServer)
+	if !ok {
+		return nil, fmt.Errorf("expected a JsonServer, got %T", newObj)
+	}
 	jsonserverlog.Info("validate update", "name", r.Name)
 
-	return r.validateJsonServer()
+	warnings, err := v.validateJsonServer(ctx, r)
+	recordAdmission("update", err)
+	return warnings, err
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *JsonServer) ValidateDelete() (admission.Warnings, error) {
-	jsonserverlog.Info("validate delete", "name", r.Name)
-
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type
+func (v *JsonServerValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	// No validation needed for delete
 	return nil, nil
 }
 
-// validateJsonServer validates the JsonServer resource
-func (r *JsonServer) validateJsonServer() (admission.Warnings, error) {
+// validateJsonServer validates the JsonServer resource. Rules that only
+// depend on the object itself are x-kubernetes-validations on the CRD and
+// also apply when the webhook is disabled; the webhook checks what CEL
+// cannot: JSON parsing, cron expressions, route rewrites, JsonServerPolicies,
+// the --max-ttl flag and the rendered expose host.
+func (v *JsonServerValidator) validateJsonServer(ctx context.Context, r *JsonServer) (admission.Warnings, error) {
 	var warnings admission.Warnings
 
-	// Validate naming convention: must start with "app-"
-	if !strings.HasPrefix(r.Name, "app-") {
-		return warnings, fmt.Errorf("metadata.name must follow the naming convention 'app-${name}': got %q", r.Name)
+	// Evaluate the JsonServerPolicies selecting the namespace
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	policies, err := r.applicablePolicies(ctx, v.Reader)
+	if err != nil {
+		return warnings, rejectedBy(rulePolicyError, fmt.Errorf("failed to evaluate JsonServerPolicies: %w", err))
+	}
+	if err := r.checkPolicies(policies); err != nil {
+		return warnings, err
+	}
+
+	// Validate naming convention: must start with "app-", unless a policy sets nameRegex
+	if !hasNameRegex(policies) {
+		if !strings.HasPrefix(r.Name, "app-") {
+			return warnings, rejectedBy(ruleNamePrefix, fmt.Errorf("metadata.name must follow the naming convention 'app-${name}': got %q", r.Name))
+		}
+
+		// Validate that the name after "app-" is not empty
+		nameAfterPrefix := strings.TrimPrefix(r.Name, "app-")
+		if nameAfterPrefix == "" {
+			return warnings, rejectedBy(ruleNamePrefix, fmt.Errorf("metadata.name must follow the naming convention 'app-${name}': name after 'app-' cannot be empty"))
+		}
+	}
+
+	// Validate that jsonConfig is valid JSON. Referenced sources are checked by the controller
+	if r.Spec.JsonConfig != "" {
+		var js interface{}
+		if err := json.Unmarshal([]byte(r.Spec.JsonConfig), &js); err != nil {
+			return warnings, rejectedBy(ruleJsonConfig, fmt.Errorf("spec.jsonConfig is not a valid json object"))
+		}
+	}
+
+	// Warn when the inline data comes close to the object size limits
+	if size := len(r.Spec.JsonConfig); size > objectSizeWarningThreshold {
+		warnings = append(warnings, fmt.Sprintf("spec.jsonConfig is %d bytes and the JsonServer is close to the 1.5MiB object size limit, move the data to a ConfigMap or Secret and use spec.source", size))
+	} else if size > ConfigCompressionThreshold {
+		warnings = append(warnings, fmt.Sprintf("spec.jsonConfig is %d bytes, above %d bytes the data is stored gzip-compressed and unpacked by an init container", size, ConfigCompressionThreshold))
+	}
+
+	// Validate reset schedule
+	if r.Spec.ResetSchedule != "" {
+		if _, err := cron.ParseStandard(r.Spec.ResetSchedule); err != nil {
+			return warnings, rejectedBy(ruleResetSchedule, fmt.Errorf("spec.resetSchedule is not a valid cron expression: %v", err))
+		}
 	}
 
-	// Validate that the name after "app-" is not empty
-	nameAfterPrefix := strings.TrimPrefix(r.Name, "app-")
-	if nameAfterPrefix == "" {
-		return warnings, fmt.Errorf("metadata.name must follow the naming convention 'app-${name}': name after 'app-' cannot be empty")
+	// Validate that route targets only refer to wildcards and parameters of their rule
+	if err := validateRoutes(r.Spec.Routes); err != nil {
+		return warnings, rejectedBy(ruleRoutes, err)
 	}
 
-	// Validate JSON config
-	if r.Spec.JsonConfig == "" {
-		return warnings, fmt.Errorf("spec.jsonConfig is required")
+	// Validate the lifetime against MaxTTL, counting from now for new objects
+	created := r.CreationTimestamp.Time
+	if created.IsZero() {
+		created = time.Now()
+	}
+	if ttl := r.Spec.TTLSecondsAfterCreation; ttl != nil && MaxTTL > 0 && time.Duration(*ttl)*time.Second > MaxTTL {
+		return warnings, rejectedBy(ruleMaxTTL, fmt.Errorf("spec.ttlSecondsAfterCreation must not exceed %d, the maximum TTL of %s", int64(MaxTTL/time.Second), MaxTTL))
+	}
+	if at := r.Spec.ExpiresAt; at != nil {
+		if MaxTTL > 0 && at.Sub(created) > MaxTTL {
+			return warnings, rejectedBy(ruleMaxTTL, fmt.Errorf("spec.expiresAt must be at most %s after creation, got %s", MaxTTL, at.UTC().Format(time.RFC3339)))
+		}
+		if !at.After(time.Now()) {
+			warnings = append(warnings, "spec.expiresAt is in the past, the JsonServer will be deleted")
+		}
 	}
 
-	// Validate that jsonConfig is valid JSON
-	var js interface{}
-	if err := json.Unmarshal([]byte(r.Spec.JsonConfig), &js); err != nil {
-		return warnings, fmt.Errorf("spec.jsonConfig is not a valid json object")
+	// Warn about settings that are valid but easy to misread
+	if r.Spec.Suspend {
+		warnings = append(warnings, "spec.suspend is set, json-server is scaled to zero and its Service has no endpoints")
 	}
 
-	// Validate replicas
-	if r.Spec.Replicas < 1 {
-		return warnings, fmt.Errorf("spec.replicas must be at least 1")
+	// Validate the rendered expose host, which depends on the name and namespace
+	if expose := r.Spec.Expose; expose != nil {
+		host := expose.RenderHost(r.Name, r.Namespace)
+		if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+			return warnings, rejectedBy(ruleExposeHost, fmt.Errorf("spec.expose.host %q is not a valid host name: %s", host, strings.Join(errs, ", ")))
+		}
+		if expose.Type == ExposeTypeIngress && expose.PathPrefix != "" && expose.PathPrefix != "/" {
+			warnings = append(warnings, "spec.expose.pathPrefix is passed to json-server unchanged with an Ingress, add a rewrite annotation for your ingress controller if needed")
+		}
 	}
 
 	return warnings, nil
 }
+
+var (
+	// routeParamPattern matches the :name parameters of a route
+	routeParamPattern = regexp.MustCompile(`:(\w+)`)
+
+	// routeEscapePattern matches the backslash-escaped characters of a route
+	routeEscapePattern = regexp.MustCompile(`\\.`)
+
+	// routeGroupRefPattern matches the $1, $2, ... references of a route target
+	routeGroupRefPattern = regexp.MustCompile(`\$(\d+)`)
+)
+
+// validateRoutes checks the spec.routes rewrite rules. Both sides must be
+// paths, and a target may only refer to the wildcards and parameters of its rule.
+func validateRoutes(routes map[string]string) error {
+	keys := make([]string, 0, len(routes))
+	for from := range routes {
+		keys = append(keys, from)
+	}
+	sort.Strings(keys)
+
+	for _, from := range keys {
+		to := routes[from]
+		if !strings.HasPrefix(from, "/") {
+			return fmt.Errorf("spec.routes: rule %q must start with /", from)
+		}
+		if !strings.HasPrefix(to, "/") {
+			return fmt.Errorf("spec.routes[%q]: target %q must start with /", from, to)
+		}
+
+		pattern := routeEscapePattern.ReplaceAllString(from, "")
+		params := map[string]bool{}
+		for _, m := range routeParamPattern.FindAllStringSubmatch(pattern, -1) {
+			params[m[1]] = true
+		}
+		groups := strings.Count(pattern, "*") + len(routeParamPattern.FindAllString(pattern, -1))
+		for _, m := range routeGroupRefPattern.FindAllStringSubmatch(to, -1) {
+			if n, _ := strconv.Atoi(m[1]); n < 1 || n > groups {
+				return fmt.Errorf("spec.routes[%q]: target refers to $%s, but the rule has %d wildcards and parameters", from, m[1], groups)
+			}
+		}
+		for _, m := range routeParamPattern.FindAllStringSubmatch(to, -1) {
+			if !params[m[1]] {
+				return fmt.Errorf("spec.routes[%q]: target refers to :%s, which the rule does not define", from, m[1])
+			}
+		}
+	}
+	return nil
+}
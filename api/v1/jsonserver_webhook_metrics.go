@@ -0,0 +1,91 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Webhook rules reported in the rule label of jsonserver_webhook_admissions_total.
+// Violated JsonServerPolicies report the rule of the policy, e.g. maxReplicas.
+const (
+	ruleNamePrefix    = "namePrefix"
+	ruleJsonConfig    = "jsonConfig"
+	ruleResetSchedule = "resetSchedule"
+	ruleRoutes        = "routes"
+	ruleMaxTTL        = "maxTTL"
+	ruleExposeHost    = "exposeHost"
+	rulePolicyError   = "policyError"
+)
+
+var webhookAdmissions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "jsonserver_webhook_admissions_total",
+	Help: "JsonServer admissions by operation, result and the rule that rejected them",
+}, []string{"operation", "result", "rule"})
+
+// registerWebhookMetrics adds the webhook collectors to the controller-runtime
+// registry, so that only managers serving the webhook export them
+func registerWebhookMetrics() error {
+	err := metrics.Registry.Register(webhookAdmissions)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		return nil
+	}
+	return err
+}
+
+// ruleError is a webhook rejection together with the rule that caused it
+type ruleError struct {
+	rule string
+	err  error
+}
+
+func (e *ruleError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ruleError) Unwrap() error {
+	return e.err
+}
+
+// rejectedBy marks err as a rejection by the given webhook rule
+func rejectedBy(rule string, err error) error {
+	return &ruleError{rule: rule, err: err}
+}
+
+// recordAdmission counts the outcome of a validation. Rejections report the
+// rule of the first violation.
+func recordAdmission(operation string, err error) {
+	if err == nil {
+		webhookAdmissions.WithLabelValues(operation, "allowed", "").Inc()
+		return
+	}
+
+	rule := "unknown"
+	var ruleErr *ruleError
+	var violation *PolicyViolation
+	switch {
+	case errors.As(err, &ruleErr):
+		rule = ruleErr.rule
+	case errors.As(err, &violation):
+		rule = violation.Rule
+	}
+	webhookAdmissions.WithLabelValues(operation, "denied", rule).Inc()
+}
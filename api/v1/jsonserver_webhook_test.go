@@ -1,7 +1,17 @@
 package v1
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestValidateName_Valid(t *testing.T) {
@@ -10,7 +20,7 @@ func TestValidateName_Valid(t *testing.T) {
 	js.Spec.Replicas = 1
 	js.Spec.JsonConfig = `{"data": []}`
 
-	_, err := js.ValidateCreate()
+	_, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
 	if err != nil {
 		t.Errorf("expected valid name to pass: %v", err)
 	}
@@ -22,7 +32,7 @@ func TestValidateName_Invalid(t *testing.T) {
 	js.Spec.Replicas = 1
 	js.Spec.JsonConfig = `{"data": []}`
 
-	_, err := js.ValidateCreate()
+	_, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
 	if err == nil {
 		t.Error("expected invalid name to fail")
 	}
@@ -34,7 +44,7 @@ func TestValidateJsonConfig_Valid(t *testing.T) {
 	js.Spec.Replicas = 1
 	js.Spec.JsonConfig = `{"users": [{"id": 1}]}`
 
-	_, err := js.ValidateCreate()
+	_, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
 	if err != nil {
 		t.Errorf("expected valid json to pass: %v", err)
 	}
@@ -46,8 +56,230 @@ func TestValidateJsonConfig_Invalid(t *testing.T) {
 	js.Spec.Replicas = 1
 	js.Spec.JsonConfig = `{invalid json}`
 
-	_, err := js.ValidateCreate()
+	_, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
 	if err == nil {
 		t.Error("expected invalid json to fail")
 	}
 }
+
+func TestValidateJsonConfig_WarnsWhenLarge(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+
+	warnings, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected small jsonConfig to pass without warnings, got %v, %v", warnings, err)
+	}
+
+	js.Spec.JsonConfig = `{"blob": "` + strings.Repeat("x", ConfigCompressionThreshold) + `"}`
+	warnings, err = (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+	if err != nil {
+		t.Errorf("expected large jsonConfig to pass: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected a compression warning, got %v", warnings)
+	}
+}
+
+func TestValidateResetSchedule(t *testing.T) {
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.ResetSchedule = "0 6 * * 1-5"
+
+	_, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+	if err != nil {
+		t.Errorf("expected valid cron expression to pass: %v", err)
+	}
+
+	js.Spec.ResetSchedule = "every morning"
+	_, err = (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+	if err == nil {
+		t.Error("expected invalid cron expression to fail")
+	}
+}
+
+func TestValidateTTL_MaxTTL(t *testing.T) {
+	MaxTTL = 24 * time.Hour
+	defer func() { MaxTTL = 0 }()
+
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+	js.Spec.TTLSecondsAfterCreation = ptr.To(int64(3600))
+
+	_, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+	if err != nil {
+		t.Errorf("expected TTL below the maximum to pass: %v", err)
+	}
+
+	js.Spec.TTLSecondsAfterCreation = ptr.To(int64(48 * 3600))
+	_, err = (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+	if err == nil {
+		t.Error("expected TTL above the maximum to fail")
+	}
+
+	js.Spec.TTLSecondsAfterCreation = nil
+	js.Spec.ExpiresAt = &metav1.Time{Time: time.Now().Add(72 * time.Hour)}
+	_, err = (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+	if err == nil {
+		t.Error("expected expiresAt beyond the maximum to fail")
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	namespace := &corev1.Namespace{}
+	namespace.Name = "payments"
+	namespace.Labels = map[string]string{"team": "payments"}
+
+	payments := &JsonServerPolicy{}
+	payments.Name = "payments"
+	payments.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}
+	payments.Spec.NameRegex = "^payments-"
+	payments.Spec.MaxReplicas = ptr.To(int32(2))
+	payments.Spec.AllowedImages = []string{"registry.example.com/mocks/*"}
+
+	global := &JsonServerPolicy{}
+	global.Name = "global"
+	global.Spec.RequiredLabels = []string{"owner"}
+
+	validator := &JsonServerValidator{Reader: fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(namespace, payments, global).
+		Build()}
+
+	js := &JsonServer{}
+	js.Name = "payments-orders"
+	js.Namespace = "payments"
+	js.Labels = map[string]string{"owner": "team-payments"}
+	js.Spec.Replicas = 2
+	js.Spec.JsonConfig = `{"orders": []}`
+	js.Spec.Image = "registry.example.com/mocks/json-server:1.0"
+
+	// nameRegex replaces the app- prefix rule
+	_, err := validator.ValidateCreate(context.Background(), js)
+	if err != nil {
+		t.Errorf("expected JsonServer following the policies to pass: %v", err)
+	}
+
+	js.Spec.Replicas = 3
+	_, err = validator.ValidateCreate(context.Background(), js)
+	if err == nil || !strings.Contains(err.Error(), `JsonServerPolicy "payments" rule maxReplicas`) {
+		t.Errorf("expected maxReplicas violation, got %v", err)
+	}
+
+	js.Spec.Replicas = 1
+	js.Spec.Image = "docker.io/other/json-server"
+	js.Labels = nil
+	_, err = validator.ValidateCreate(context.Background(), js)
+	if err == nil || !strings.Contains(err.Error(), "rule allowedImages") || !strings.Contains(err.Error(), `JsonServerPolicy "global" rule requiredLabels`) {
+		t.Errorf("expected allowedImages and requiredLabels violations, got %v", err)
+	}
+
+	// Namespaces not selected by a policy keep the app- prefix rule
+	other := &JsonServer{}
+	other.Name = "payments-orders"
+	other.Namespace = "default"
+	other.Labels = map[string]string{"owner": "someone"}
+	other.Spec.Replicas = 1
+	other.Spec.JsonConfig = `{"orders": []}`
+	validator.Reader = fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(namespace, payments, global, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}).
+		Build()
+	_, err = validator.ValidateCreate(context.Background(), other)
+	if err == nil || !strings.Contains(err.Error(), "app-") {
+		t.Errorf("expected the app- prefix rule outside the payments namespace, got %v", err)
+	}
+}
+
+func TestValidate_AdmissionMetrics(t *testing.T) {
+	// Every webhook setup registers the collectors, which must not fail the second time
+	for i := 0; i < 2; i++ {
+		if err := registerWebhookMetrics(); err != nil {
+			t.Fatalf("failed to register webhook metrics: %v", err)
+		}
+	}
+
+	allowed := testutil.ToFloat64(webhookAdmissions.WithLabelValues("create", "allowed", ""))
+	denied := testutil.ToFloat64(webhookAdmissions.WithLabelValues("create", "denied", ruleJsonConfig))
+
+	js := &JsonServer{}
+	js.Name = "app-test"
+	js.Spec.Replicas = 1
+	js.Spec.JsonConfig = `{"users": []}`
+
+	if _, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js); err != nil {
+		t.Fatalf("expected valid JsonServer to pass: %v", err)
+	}
+	js.Spec.JsonConfig = `{invalid json}`
+	if _, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js); err == nil {
+		t.Fatal("expected invalid json to fail")
+	}
+
+	if got := testutil.ToFloat64(webhookAdmissions.WithLabelValues("create", "allowed", "")); got != allowed+1 {
+		t.Errorf("expected one more allowed admission, got %v", got-allowed)
+	}
+	if got := testutil.ToFloat64(webhookAdmissions.WithLabelValues("create", "denied", ruleJsonConfig)); got != denied+1 {
+		t.Errorf("expected one more admission denied by the jsonConfig rule, got %v", got-denied)
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	tests := []struct {
+		routes map[string]string
+		valid  bool
+	}{
+		{map[string]string{"/api/v2/*": "/$1"}, true},
+		{map[string]string{"/blog/:resource/:id/show": "/:resource/:id", "/articles\\?id=:id": "/posts/$1"}, true},
+		{map[string]string{"api/*": "/$1"}, false},
+		{map[string]string{"/api/*": "$1"}, false},
+		{map[string]string{"/api/*": "/$2"}, false},
+		{map[string]string{"/users/:id": "/people/:name"}, false},
+	}
+	for _, tt := range tests {
+		js := &JsonServer{}
+		js.Name = "app-test"
+		js.Spec.Replicas = 1
+		js.Spec.JsonConfig = `{"users": []}`
+		js.Spec.Routes = tt.routes
+
+		_, err := (&JsonServerValidator{}).ValidateCreate(context.Background(), js)
+		if tt.valid && err != nil {
+			t.Errorf("expected routes %v to pass: %v", tt.routes, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("expected routes %v to fail", tt.routes)
+		}
+	}
+}
+
+func TestValidatePolicy_InvalidRules(t *testing.T) {
+	policy := &JsonServerPolicy{}
+	policy.Name = "payments"
+	policy.Spec.NameRegex = "^app-payments-"
+	policy.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}
+
+	if _, err := policy.ValidateCreate(); err != nil {
+		t.Errorf("expected valid policy to pass: %v", err)
+	}
+
+	policy.Spec.NameRegex = "^app-(payments"
+	if _, err := policy.ValidateCreate(); err == nil || !strings.Contains(err.Error(), "spec.nameRegex") {
+		t.Errorf("expected invalid nameRegex to fail, got %v", err)
+	}
+
+	policy.Spec.NameRegex = ""
+	policy.Spec.NamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Near"}}}
+	if _, err := policy.ValidateCreate(); err == nil || !strings.Contains(err.Error(), "spec.namespaceSelector") {
+		t.Errorf("expected invalid namespaceSelector to fail, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// JsonServerPolicySpec defines the rules JsonServers in the selected namespaces must follow
+type JsonServerPolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to.
+	// An empty or missing selector selects all namespaces
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// NameRegex is a regular expression JsonServer names must match, e.g. "^team-[a-z]+-".
+	// It replaces the default "app-" prefix rule
+	// +optional
+	NameRegex string `json:"nameRegex,omitempty"`
+
+	// MaxReplicas is the highest spec.replicas allowed
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// MaxConfigSize is the largest inline spec.jsonConfig allowed, e.g. "256Ki".
+	// Data loaded through spec.source or spec.restoreFrom is not checked
+	// +optional
+	MaxConfigSize *resource.Quantity `json:"maxConfigSize,omitempty"`
+
+	// AllowedImages lists the images spec.image may use. An entry ending in
+	// "*" allows every image starting with the text before it, e.g.
+	// "registry.example.com/mocks/*". JsonServers without spec.image use the
+	// controller default image, which is always allowed
+	// +optional
+	AllowedImages []string `json:"allowedImages,omitempty"`
+
+	// RequiredLabels are label keys every JsonServer must set
+	// +optional
+	RequiredLabels []string `json:"requiredLabels,omitempty"`
+
+	// RequiredAnnotations are annotation keys every JsonServer must set
+	// +optional
+	RequiredAnnotations []string `json:"requiredAnnotations,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Name Regex",type=string,JSONPath=`.spec.nameRegex`
+// +kubebuilder:printcolumn:name="Max Replicas",type=integer,JSONPath=`.spec.maxReplicas`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// JsonServerPolicy is the Schema for the jsonserverpolicies API. The
+// JsonServer webhook rejects JsonServers that violate any policy selecting
+// their namespace
+type JsonServerPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec JsonServerPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// JsonServerPolicyList contains a list of JsonServerPolicy
+type JsonServerPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []JsonServerPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&JsonServerPolicy{}, &JsonServerPolicyList{})
+}
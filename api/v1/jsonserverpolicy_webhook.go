@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"regexp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var jsonserverpolicylog = logf.Log.WithName("jsonserverpolicy-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *JsonServerPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-example-com-v1-jsonserverpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=example.com,resources=jsonserverpolicies,verbs=create;update,versions=v1,name=vjsonserverpolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &JsonServerPolicy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *JsonServerPolicy) ValidateCreate() (admission.Warnings, error) {
+	jsonserverpolicylog.Info("validate create", "name", r.Name)
+
+	return nil, r.validateJsonServerPolicy()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *JsonServerPolicy) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	jsonserverpolicylog.Info("validate update", "name", r.Name)
+
+	return nil, r.validateJsonServerPolicy()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *JsonServerPolicy) ValidateDelete() (admission.Warnings, error) {
+	// No validation needed for delete
+	return nil, nil
+}
+
+// validateJsonServerPolicy rejects policies that could not be evaluated and
+// would otherwise reject every JsonServer in the selected namespaces
+func (r *JsonServerPolicy) validateJsonServerPolicy() error {
+	if r.Spec.NameRegex != "" {
+		if _, err := regexp.Compile(r.Spec.NameRegex); err != nil {
+			return fmt.Errorf("spec.nameRegex is not a valid regular expression: %v", err)
+		}
+	}
+
+	if selector := r.Spec.NamespaceSelector; selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+			return fmt.Errorf("spec.namespaceSelector is invalid: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SnapshotTarget selects the kind of object a snapshot is stored in
+// +kubebuilder:validation:Enum=ConfigMap;Secret
+type SnapshotTarget string
+
+const (
+	// SnapshotTargetConfigMap stores the snapshot in a ConfigMap
+	SnapshotTargetConfigMap SnapshotTarget = "ConfigMap"
+
+	// SnapshotTargetSecret stores the snapshot in a Secret
+	SnapshotTargetSecret SnapshotTarget = "Secret"
+)
+
+// Snapshot phases
+const (
+	SnapshotPhasePending   = "Pending"
+	SnapshotPhaseCompleted = "Completed"
+	SnapshotPhaseFailed    = "Failed"
+)
+
+// JsonServerSnapshotSpec defines the desired state of JsonServerSnapshot.
+// A snapshot is taken once, so the spec cannot be changed afterwards
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable, create a new JsonServerSnapshot instead"
+type JsonServerSnapshotSpec struct {
+	// JsonServerName is the JsonServer in the same namespace whose live data is captured
+	// +kubebuilder:validation:MinLength=1
+	JsonServerName string `json:"jsonServerName"`
+
+	// Target is the kind of object the data is stored in, "ConfigMap" or "Secret".
+	// The object is named after the snapshot and holds db.json, or db.json.gz
+	// when the data is larger than 768KiB
+	// +kubebuilder:default=ConfigMap
+	// +optional
+	Target SnapshotTarget `json:"target,omitempty"`
+}
+
+// JsonServerSnapshotStatus defines the observed state of JsonServerSnapshot
+type JsonServerSnapshotStatus struct {
+	// Phase is "Pending" until the data is captured, then "Completed" or "Failed"
+	// +kubebuilder:validation:Enum=Pending;Completed;Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Message provides additional information about the current phase
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// DataName is the ConfigMap or Secret holding the captured data
+	// +optional
+	DataName string `json:"dataName,omitempty"`
+
+	// Size is the size of the captured db.json in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// CapturedAt is the time the data was read from the JsonServer
+	// +optional
+	CapturedAt *metav1.Time `json:"capturedAt,omitempty"`
+
+	// Resources summarizes the top-level resources of the captured data
+	// +optional
+	Resources []ResourceSummary `json:"resources,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="JsonServer",type=string,JSONPath=`.spec.jsonServerName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Size",type=integer,JSONPath=`.status.size`
+// +kubebuilder:printcolumn:name="Resources",type=string,JSONPath=`.status.resources[*].name`,priority=1
+// +kubebuilder:printcolumn:name="Captured",type="date",JSONPath=".status.capturedAt"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// JsonServerSnapshot is the Schema for the jsonserversnapshots API
+type JsonServerSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   JsonServerSnapshotSpec   `json:"spec,omitempty"`
+	Status JsonServerSnapshotStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// JsonServerSnapshotList contains a list of JsonServerSnapshot
+type JsonServerSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []JsonServerSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&JsonServerSnapshot{}, &JsonServerSnapshotList{})
+}
@@ -19,21 +19,32 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
 	"github.com/yourusername/json-server-controller/internal/controller"
@@ -48,16 +59,29 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(gatewayv1.AddToScheme(scheme))
+
 	utilruntime.Must(examplecomv1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	// The manager binary also serves the data of JsonServers with spec.runtime go
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		os.Exit(serve(os.Args[2:]))
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var defaultImage string
+	var seedImage string
+	var goRuntimeImage string
+	var activatorAddr string
+	var activatorIP string
+	var maxTTL time.Duration
 	var tlsOpts []func(*tls.Config)
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
@@ -70,6 +94,18 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&defaultImage, "default-image", controller.DefaultImage,
+		"The json-server image used for JsonServers that do not set spec.image.")
+	flag.StringVar(&seedImage, "seed-image", controller.DefaultSeedImage,
+		"The image with a POSIX shell and gunzip that seeds persistent volumes and unpacks compressed data.")
+	flag.StringVar(&goRuntimeImage, "go-runtime-image", os.Getenv("GO_RUNTIME_IMAGE"),
+		"The image running 'manager serve' for JsonServers with spec.runtime go. Defaults to the GO_RUNTIME_IMAGE environment variable.")
+	flag.StringVar(&activatorAddr, "activator-bind-address", fmt.Sprintf(":%d", controller.DefaultActivatorPort),
+		"The address the activator for JsonServers with spec.idle binds to, or 0 to disable it.")
+	flag.StringVar(&activatorIP, "activator-address", os.Getenv("POD_IP"),
+		"The pod IP the activator is reachable at. Defaults to the POD_IP environment variable.")
+	flag.DurationVar(&maxTTL, "max-ttl", 0,
+		"The maximum lifetime the webhook accepts in spec.ttlSecondsAfterCreation and spec.expiresAt, e.g. 168h. 0 allows any lifetime.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -115,33 +151,92 @@ func main() {
 		metricsServerOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	cfg := ctrl.GetConfigOrDie()
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "json-server-controller.example.com",
+		// Never cache Secrets, only their metadata is watched
+		Client: client.Options{
+			Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}}},
+		},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controller.JsonServerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	// HTTPRoute support is only enabled when the Gateway API CRDs are installed
+	gatewayAPI, err := hasGatewayAPI(cfg)
+	if err != nil {
+		setupLog.Error(err, "unable to discover the Gateway API")
+		os.Exit(1)
+	}
+	setupLog.Info("gateway API discovery", "enabled", gatewayAPI)
+
+	// The activator holds requests to idle JsonServers until they are scaled up again
+	reconciler := &controller.JsonServerReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		DefaultImage:   defaultImage,
+		SeedImage:      seedImage,
+		GoRuntimeImage: goRuntimeImage,
+		GatewayAPI:     gatewayAPI,
+		Recorder:       mgr.GetEventRecorderFor("json-server-controller"),
+		APIReader:      mgr.GetAPIReader(),
+	}
+	if activatorAddr != "0" {
+		_, port, err := net.SplitHostPort(activatorAddr)
+		if err != nil {
+			setupLog.Error(err, "invalid activator bind address")
+			os.Exit(1)
+		}
+		activatorPort, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			setupLog.Error(err, "invalid activator bind address")
+			os.Exit(1)
+		}
+		if err := (&controller.Activator{
+			Client:      mgr.GetClient(),
+			APIReader:   mgr.GetAPIReader(),
+			BindAddress: activatorAddr,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to add activator")
+			os.Exit(1)
+		}
+		reconciler.ActivatorAddress = activatorIP
+		reconciler.ActivatorPort = int32(activatorPort)
+	}
+	setupLog.Info("activator", "enabled", reconciler.ActivatorAddress != "", "address", reconciler.ActivatorAddress)
+
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "JsonServer")
 		os.Exit(1)
 	}
+	if err = (&controller.JsonServerSnapshotReconciler{
+		Client:     mgr.GetClient(),
+		Scheme:     mgr.GetScheme(),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		APIReader:  mgr.GetAPIReader(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "JsonServerSnapshot")
+		os.Exit(1)
+	}
 
 	// Setup webhooks
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		examplecomv1.MaxTTL = maxTTL
 		if err = (&examplecomv1.JsonServer{}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "JsonServer")
 			os.Exit(1)
 		}
+		if err = (&examplecomv1.JsonServerPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "JsonServerPolicy")
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
@@ -160,3 +255,26 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// hasGatewayAPI reports whether the cluster serves the Gateway API HTTPRoute resource
+func hasGatewayAPI(cfg *rest.Config) (bool, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	resources, err := dc.ServerResourcesForGroupVersion(gatewayv1.GroupVersion.String())
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Kind == "HTTPRoute" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/yourusername/json-server-controller/internal/jsonserver"
+)
+
+// serve runs the Go json-server runtime used by JsonServers with spec.runtime go:
+//
+//	manager serve [--port 3000] [--watch] [--routes /data/routes.json] /data/db.json
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	port := fs.Int("port", 3000, "The port json-server listens on.")
+	host := fs.String("host", "", "The address json-server binds to, all interfaces when empty.")
+	watch := fs.Bool("watch", false, "Reload db.json when the file changes.")
+	routes := fs.String("routes", "", "A routes.json file of rewrite rules.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s serve [flags] <db.json>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	opts := zap.Options{}
+	opts.BindFlags(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	log := ctrl.Log.WithName("serve")
+
+	server, err := jsonserver.Load(fs.Arg(0))
+	if err != nil {
+		log.Error(err, "unable to load data")
+		return 1
+	}
+	server.Log = log
+	if *routes != "" {
+		if server.Rewriter, err = jsonserver.LoadRoutes(*routes); err != nil {
+			log.Error(err, "unable to load routes")
+			return 1
+		}
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	if *watch {
+		go server.Watch(ctx, time.Second)
+	}
+
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", *host, *port),
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("serving json-server", "address", httpServer.Addr, "data", fs.Arg(0), "watch", *watch)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "problem running json-server")
+		return 1
+	}
+	return 0
+}
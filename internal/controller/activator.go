@@ -0,0 +1,376 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+const (
+	// DefaultActivatorPort is the port the activator listens on
+	DefaultActivatorPort int32 = 8090
+
+	// defaultWakeTimeout is how long a request waits for a sleeping json-server
+	defaultWakeTimeout = 2 * time.Minute
+
+	// lastRequestInterval limits how often the last request time is written
+	// to a JsonServer that is awake
+	lastRequestInterval = time.Minute
+
+	// podIPField selects pods by IP, which the API server supports as a field selector
+	podIPField = "status.podIP"
+
+	// activatorHostIndex indexes JsonServers with spec.idle by the hosts they
+	// are reached at: <name>, <name>.<namespace> and the rendered spec.expose.host
+	activatorHostIndex = "activator.host"
+)
+
+// errNoJsonServer is returned when a request cannot be mapped to a JsonServer with spec.idle
+var errNoJsonServer = errors.New("no JsonServer with spec.idle matches the request host")
+
+// Activator receives the traffic of JsonServers with spec.idle while their
+// Service points at it, see routeThroughActivator. It records the time of
+// every request, which keeps the JsonServer awake, waits for a ready pod when
+// the JsonServer is scaled to zero and proxies the request to the pods
+// Service. Requests for JsonServers whose Service selects the pods are
+// rejected, so the activator never becomes a permanent path around the
+// NetworkPolicies of their namespace.
+type Activator struct {
+	Client client.Client
+
+	// APIReader looks up the pod a request comes from by its IP, so that pods
+	// are not cached. Defaults to the client
+	APIReader client.Reader
+
+	// BindAddress is the address the activator listens on
+	BindAddress string
+
+	// WakeTimeout is how long a request waits for a ready pod, defaults to two minutes
+	WakeTimeout time.Duration
+
+	// Transport is used to reach the pods Service, defaults to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=list
+
+// SetupWithManager indexes JsonServers by host and adds the activator to the manager
+func (a *Activator) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &examplecomv1.JsonServer{}, activatorHostIndex, indexActivatorHosts); err != nil {
+		return err
+	}
+	return mgr.Add(a)
+}
+
+// indexActivatorHosts is the field indexer for activatorHostIndex
+func indexActivatorHosts(obj client.Object) []string {
+	jsonServer := obj.(*examplecomv1.JsonServer)
+	if jsonServer.Spec.Idle == nil {
+		return nil
+	}
+
+	hosts := []string{jsonServer.Name, jsonServer.Name + "." + jsonServer.Namespace}
+	if expose := jsonServer.Spec.Expose; expose != nil {
+		hosts = append(hosts, strings.ToLower(expose.RenderHost(jsonServer.Name, jsonServer.Namespace)))
+	}
+	return hosts
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica
+// of the controller manager serves the traffic sent to its own pod IP.
+func (a *Activator) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable and serves until the context is cancelled
+func (a *Activator) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              a.BindAddress,
+		Handler:           a,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.FromContext(ctx).Info("Starting activator", "address", a.BindAddress)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP wakes the JsonServer the request is addressed to and proxies the request
+func (a *Activator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	logger := log.FromContext(ctx).WithName("activator").WithValues("host", req.Host)
+
+	jsonServer, err := a.resolve(ctx, req.Host, req.RemoteAddr)
+	if err != nil {
+		if !errors.Is(err, errNoJsonServer) {
+			logger.Error(err, "Failed to resolve JsonServer")
+		}
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	logger = logger.WithValues("JsonServer", client.ObjectKeyFromObject(jsonServer))
+
+	if jsonServer.Spec.Suspend {
+		http.Error(w, fmt.Sprintf("JsonServer %s is suspended", jsonServer.Name), http.StatusServiceUnavailable)
+		return
+	}
+
+	// Requests that reach the activator while the route drains are still
+	// served, see drainActivatorSlice
+	routed, err := a.routed(ctx, jsonServer)
+	if err != nil {
+		logger.Error(err, "Failed to get activator route")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !routed {
+		http.Error(w, fmt.Sprintf("JsonServer %s is not routed through the activator", jsonServer.Name), http.StatusMisdirectedRequest)
+		return
+	}
+
+	// Record the request, which wakes a sleeping JsonServer
+	if err := recordRequest(ctx, a.Client, jsonServer); err != nil {
+		logger.Error(err, "Failed to record request")
+	}
+
+	if err := a.waitReady(ctx, jsonServer); err != nil {
+		logger.Info("JsonServer did not become ready", "reason", err.Error())
+		http.Error(w, fmt.Sprintf("JsonServer %s is not ready: %v", jsonServer.Name, err), http.StatusServiceUnavailable)
+		return
+	}
+
+	target := &url.URL{
+		Scheme: "http",
+		Host:   fmt.Sprintf("%s.%s.svc:%d", podsServiceName(jsonServer), jsonServer.Namespace, servicePort(jsonServer)),
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Host = pr.In.Host
+		},
+		Transport: &retryTransport{base: a.transport()},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			logger.Error(err, "Failed to proxy request")
+			http.Error(w, "json-server is not reachable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
+
+// resolve finds the JsonServer with spec.idle a request host refers to. The
+// host is either the Service name, optionally followed by the namespace and
+// cluster domain, or the rendered spec.expose.host. A bare Service name
+// used in several namespaces resolves to the one in the namespace of the
+// client pod, which is found by the remote address of the request.
+func (a *Activator) resolve(ctx context.Context, host, remoteAddr string) (*examplecomv1.JsonServer, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	// <name>.<namespace>.svc... is looked up as <name>.<namespace>
+	keys := []string{host}
+	if parts := strings.Split(host, "."); len(parts) >= 3 && parts[2] == "svc" {
+		keys = append(keys, parts[0]+"."+parts[1])
+	}
+
+	found := map[types.NamespacedName]*examplecomv1.JsonServer{}
+	for _, key := range keys {
+		list := &examplecomv1.JsonServerList{}
+		if err := a.Client.List(ctx, list, client.MatchingFields{activatorHostIndex: key}); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			found[client.ObjectKeyFromObject(&list.Items[i])] = &list.Items[i]
+		}
+	}
+	if len(found) == 1 {
+		for _, jsonServer := range found {
+			return jsonServer, nil
+		}
+	}
+	if len(found) == 0 {
+		return nil, errNoJsonServer
+	}
+
+	// The same name in several namespaces
+	namespace, err := a.clientNamespace(ctx, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	for _, jsonServer := range found {
+		if jsonServer.Namespace == namespace {
+			return jsonServer, nil
+		}
+	}
+	return nil, errNoJsonServer
+}
+
+// clientNamespace returns the namespace of the pod a request comes from, or
+// an empty string when the address does not belong to a single namespace
+func (a *Activator) clientNamespace(ctx context.Context, remoteAddr string) (string, error) {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return "", nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := a.reader().List(ctx, pods, client.MatchingFields{podIPField: ip}); err != nil {
+		return "", err
+	}
+	var namespace string
+	for _, pod := range pods.Items {
+		// Host network pods share the node IP, finished pods may have handed theirs on
+		if pod.Spec.HostNetwork || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if namespace != "" && pod.Namespace != namespace {
+			return "", nil
+		}
+		namespace = pod.Namespace
+	}
+	return namespace, nil
+}
+
+// reader returns the reader used to look up client pods
+func (a *Activator) reader() client.Reader {
+	if a.APIReader != nil {
+		return a.APIReader
+	}
+	return a.Client
+}
+
+// routed reports whether the Service of the JsonServer points at the
+// activator, or did so until recently and the route is draining
+func (a *Activator) routed(ctx context.Context, jsonServer *examplecomv1.JsonServer) (bool, error) {
+	slice := &discoveryv1.EndpointSlice{}
+	err := a.Client.Get(ctx, types.NamespacedName{Name: activatorSliceName(jsonServer), Namespace: jsonServer.Namespace}, slice)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return metav1.IsControlledBy(slice, jsonServer), nil
+}
+
+// recordRequest sets the last request annotation, which wakes an idle
+// JsonServer. While the JsonServer is awake the annotation is written at
+// most once per lastRequestInterval.
+func recordRequest(ctx context.Context, c client.Client, jsonServer *examplecomv1.JsonServer) error {
+	now := time.Now()
+	if jsonServer.Status.IdleSince == nil {
+		if last, err := time.Parse(time.RFC3339, jsonServer.Annotations[examplecomv1.LastRequestAtAnnotation]); err == nil && now.Sub(last) < lastRequestInterval {
+			return nil
+		}
+	}
+
+	patch := client.MergeFrom(jsonServer.DeepCopy())
+	if jsonServer.Annotations == nil {
+		jsonServer.Annotations = map[string]string{}
+	}
+	jsonServer.Annotations[examplecomv1.LastRequestAtAnnotation] = now.UTC().Format(time.RFC3339)
+	return c.Patch(ctx, jsonServer, patch)
+}
+
+// waitReady waits until the Deployment of the JsonServer has a ready pod
+func (a *Activator) waitReady(ctx context.Context, jsonServer *examplecomv1.JsonServer) error {
+	timeout := a.WakeTimeout
+	if timeout <= 0 {
+		timeout = defaultWakeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		deployment := &appsv1.Deployment{}
+		err := a.Client.Get(ctx, client.ObjectKeyFromObject(jsonServer), deployment)
+		if err == nil && deployment.Status.ReadyReplicas > 0 {
+			return nil
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no ready pod after %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// transport returns the transport used to reach the pods Service
+func (a *Activator) transport() http.RoundTripper {
+	if a.Transport != nil {
+		return a.Transport
+	}
+	return http.DefaultTransport
+}
+
+// retryTransport retries requests without a body that fail before a response,
+// which happens while the endpoints of a freshly started pod propagate
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil || req.Body != nil || attempt == 4 {
+			return resp, err
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, err
+		case <-time.After(time.Duration(attempt+1) * 200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	examplev1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+func TestActivator_ProxiesAndRecordsRequest(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = discoveryv1.AddToScheme(scheme)
+
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		_, _ = w.Write([]byte(`[{"id": 1}]`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			Idle:       &examplev1.IdleSpec{AfterMinutes: 30},
+			JsonConfig: `{"posts": []}`,
+		},
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Status: appsv1.DeploymentStatus{
+			ReadyReplicas: 1,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer, deployment, activatorSlice(jsonServer)).
+		WithIndex(&examplev1.JsonServer{}, activatorHostIndex, indexActivatorHosts).
+		Build()
+
+	a := &Activator{
+		Client:    client,
+		Transport: &redirectTransport{target: target},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://app-test.default.svc:3000/posts", nil)
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+
+	body, _ := io.ReadAll(rec.Body)
+	if rec.Code != http.StatusOK || string(body) != `[{"id": 1}]` {
+		t.Fatalf("expected proxied response, got %d %s", rec.Code, body)
+	}
+	if requested != "/posts" {
+		t.Errorf("expected /posts to be proxied, got %s", requested)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: "app-test", Namespace: "default"}, updated)
+	if updated.Annotations[examplev1.LastRequestAtAnnotation] == "" {
+		t.Error("expected the request to be recorded")
+	}
+
+	// Unknown hosts are rejected
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://other.default.svc/posts", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown host, got %d", rec.Code)
+	}
+}
+
+func TestActivator_WakesSleepingJsonServer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = discoveryv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+			Annotations: map[string]string{
+				examplev1.LastRequestAtAnnotation: time.Now().Add(-30 * time.Second).UTC().Format(time.RFC3339),
+			},
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			Idle:       &examplev1.IdleSpec{AfterMinutes: 30},
+			JsonConfig: `{"posts": []}`,
+		},
+		Status: examplev1.JsonServerStatus{
+			IdleSince: &metav1.Time{Time: time.Now()},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer, activatorSlice(jsonServer)).
+		WithIndex(&examplev1.JsonServer{}, activatorHostIndex, indexActivatorHosts).
+		Build()
+
+	a := &Activator{
+		Client:      client,
+		WakeTimeout: 100 * time.Millisecond,
+	}
+
+	// No pod becomes ready in time
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://app-test.default/posts", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while no pod is ready, got %d", rec.Code)
+	}
+
+	// The request was recorded although the last one is recent, which wakes the JsonServer
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: "app-test", Namespace: "default"}, updated)
+	if updated.Annotations[examplev1.LastRequestAtAnnotation] == jsonServer.Annotations[examplev1.LastRequestAtAnnotation] {
+		t.Error("expected the request to a sleeping JsonServer to be recorded")
+	}
+}
+
+func TestActivator_RoutesOnlySleepingJsonServers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = discoveryv1.AddToScheme(scheme)
+
+	newJsonServer := func(namespace string) *examplev1.JsonServer {
+		return &examplev1.JsonServer{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "app-test",
+				Namespace: namespace,
+				UID:       types.UID(namespace),
+			},
+			Spec: examplev1.JsonServerSpec{
+				Replicas:   1,
+				Idle:       &examplev1.IdleSpec{AfterMinutes: 30},
+				JsonConfig: `{"posts": []}`,
+			},
+		}
+	}
+	routed := newJsonServer("default")
+	routed.Spec.Expose = &examplev1.ExposeSpec{Host: "api.example.com"}
+	direct := newJsonServer("other")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(routed, direct, activatorSlice(routed)).
+		WithIndex(&examplev1.JsonServer{}, activatorHostIndex, indexActivatorHosts).
+		Build()
+
+	a := &Activator{
+		Client:      client,
+		WakeTimeout: 100 * time.Millisecond,
+	}
+
+	// The exposed host is looked up through the index
+	jsonServer, err := a.resolve(context.Background(), "API.example.com:443", "192.0.2.1:1234")
+	if err != nil || jsonServer.Namespace != "default" {
+		t.Errorf("expected the exposed JsonServer, got %v %v", jsonServer, err)
+	}
+
+	// The Service of the other JsonServer selects its pods, the activator does not serve it
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://app-test.other.svc/posts?_limit=1", nil))
+	if rec.Code != http.StatusMisdirectedRequest {
+		t.Errorf("expected 421 for a JsonServer served by its pods, got %d", rec.Code)
+	}
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: "app-test", Namespace: "other"}, updated)
+	if updated.Annotations[examplev1.LastRequestAtAnnotation] != "" {
+		t.Error("expected the request to a JsonServer served by its pods not to be recorded")
+	}
+}
+
+func TestActivator_ResolvesBareNameByClientNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	newJsonServer := func(namespace string) *examplev1.JsonServer {
+		return &examplev1.JsonServer{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-test", Namespace: namespace},
+			Spec: examplev1.JsonServerSpec{
+				Replicas:   1,
+				Idle:       &examplev1.IdleSpec{AfterMinutes: 30},
+				JsonConfig: `{"posts": []}`,
+			},
+		}
+	}
+	newPod := func(name, namespace, ip string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Status:     corev1.PodStatus{PodIP: ip, Phase: corev1.PodRunning},
+		}
+	}
+	// A host network pod shares the IP of the client pod
+	hostNetwork := newPod("node-agent", "kube-system", "10.0.0.7")
+	hostNetwork.Spec.HostNetwork = true
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(newJsonServer("team-a"), newJsonServer("team-b"),
+			newPod("client", "team-b", "10.0.0.7"), hostNetwork,
+			newPod("shared-a", "team-a", "10.0.0.8"), newPod("shared-b", "team-b", "10.0.0.8")).
+		WithIndex(&examplev1.JsonServer{}, activatorHostIndex, indexActivatorHosts).
+		WithIndex(&corev1.Pod{}, podIPField, func(obj client.Object) []string {
+			return []string{obj.(*corev1.Pod).Status.PodIP}
+		}).
+		Build()
+	a := &Activator{Client: c}
+
+	// The bare name resolves to the JsonServer in the namespace of the client pod
+	jsonServer, err := a.resolve(context.Background(), "app-test:3000", "10.0.0.7:41234")
+	if err != nil || jsonServer.Namespace != "team-b" {
+		t.Errorf("expected the JsonServer in the client namespace, got %v %v", jsonServer, err)
+	}
+
+	// Qualified names do not depend on the client
+	jsonServer, err = a.resolve(context.Background(), "app-test.team-a.svc", "10.0.0.7:41234")
+	if err != nil || jsonServer.Namespace != "team-a" {
+		t.Errorf("expected the JsonServer of the qualified name, got %v %v", jsonServer, err)
+	}
+
+	// Unknown clients and addresses used in several namespaces stay ambiguous
+	for _, remoteAddr := range []string{"10.0.0.9:41234", "10.0.0.8:41234", "not-an-address"} {
+		if _, err := a.resolve(context.Background(), "app-test", remoteAddr); err != errNoJsonServer {
+			t.Errorf("expected an ambiguous bare name from %s to be rejected, got %v", remoteAddr, err)
+		}
+	}
+}
+
+// activatorSlice returns the EndpointSlice pointing the Service of the JsonServer at the activator
+func activatorSlice(jsonServer *examplev1.JsonServer) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      activatorSliceName(jsonServer),
+			Namespace: jsonServer.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: examplev1.GroupVersion.String(),
+					Kind:       "JsonServer",
+					Name:       jsonServer.Name,
+					UID:        jsonServer.UID,
+					Controller: ptr.To(true),
+				},
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+const (
+	// maxConfigMapPayload is the largest chunk of db.json stored in one ConfigMap,
+	// leaving headroom below the 1MiB object limit for metadata
+	maxConfigMapPayload = 900 * 1024
+
+	// configShardLabel is set on the extra ConfigMaps holding parts of a sharded db.json
+	configShardLabel = "example.com/config-shard"
+)
+
+// configPayload is db.json as it is stored in ConfigMaps
+type configPayload struct {
+	// plain is the uncompressed db.json, empty when compressed or referenced
+	plain string
+
+	// chunks holds the gzip-compressed db.json split into ConfigMap-sized parts
+	chunks [][]byte
+
+	// routes is the routes.json of spec.routes, empty without routes
+	routes string
+}
+
+// compressed reports whether db.json is stored gzip-compressed
+func (p *configPayload) compressed() bool {
+	return len(p.chunks) > 0
+}
+
+// dataLayout describes how db.json reaches the json-server pods
+type dataLayout struct {
+	// configHash is the hash of the rendered data, which identifies the revision
+	configHash string
+
+	// configMaps are the ConfigMaps of the revision mounted into the pods, the
+	// first one is the main ConfigMap and the rest hold further chunks of db.json
+	configMaps []string
+
+	// compressed is true when an init container has to unpack db.json
+	compressed bool
+
+	// routes is true when the revision contains a routes.json
+	routes bool
+
+	// files are the uncompressed files of the main ConfigMap of the revision
+	files map[string]string
+
+	// current is the mutable ConfigMap mounted instead of the revision with the
+	// InPlace reload strategy, empty when the revision is mounted
+	current string
+}
+
+// renderPayload decides how the inline or restored jsonConfig is stored. Data
+// above examplecomv1.ConfigCompressionThreshold is gzip-compressed and split
+// into chunks of at most maxConfigMapPayload bytes.
+func renderPayload(jsonServer *examplecomv1.JsonServer, jsonConfig string) (*configPayload, error) {
+	routes, err := renderRoutes(jsonServer)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasSourceRef(jsonServer) {
+		return &configPayload{routes: routes}, nil
+	}
+
+	if len(jsonConfig) <= examplecomv1.ConfigCompressionThreshold {
+		return &configPayload{plain: jsonConfig, routes: routes}, nil
+	}
+
+	compressed, err := compressData([]byte(jsonConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &configPayload{routes: routes}
+	for len(compressed) > 0 {
+		n := min(len(compressed), maxConfigMapPayload)
+		payload.chunks = append(payload.chunks, compressed[:n])
+		compressed = compressed[n:]
+	}
+	return payload, nil
+}
+
+// renderRoutes returns the routes.json of spec.routes, or an empty string
+// without routes. Keys are sorted, which is the order the rules apply in.
+func renderRoutes(jsonServer *examplecomv1.JsonServer) (string, error) {
+	if len(jsonServer.Spec.Routes) == 0 {
+		return "", nil
+	}
+	data, err := json.MarshalIndent(jsonServer.Spec.Routes, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// compressData gzip-compresses data with the best compression
+func compressData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunkKey returns the ConfigMap key of the i-th compressed chunk.
+// Keys sort in chunk order so the init container can concatenate them with a glob.
+func chunkKey(i int) string {
+	return fmt.Sprintf("db.json.gz.%03d", i)
+}
+
+// decompressChunks reassembles and unpacks compressed db.json chunks
+func decompressChunks(chunks [][]byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// unpackScript returns the shell script run by the init container to place
+// db.json in the data volume. In Persistent mode existing data is kept unless
+// $RESET_TOKEN differs from the token stored with the last reset. routes.json
+// is not data changed through the API and is always replaced.
+func unpackScript(jsonServer *examplecomv1.JsonServer, layout *dataLayout) string {
+	install := "cp /seed/db.json /data/db.json"
+	if layout.compressed {
+		install = "cat /seed/db.json.gz.* | gunzip > /data/db.json.tmp && mv /data/db.json.tmp /data/db.json"
+	}
+
+	if isPersistent(jsonServer) {
+		install = fmt.Sprintf(`if [ ! -f /data/db.json ] || [ "$(cat /data/.reset-token 2>/dev/null)" != "$RESET_TOKEN" ]; then %s && echo -n "$RESET_TOKEN" > /data/.reset-token; fi`, install)
+	}
+	if layout.routes {
+		install += " && cp /seed/routes.json /data/routes.json"
+	}
+	// Keep the files writable for the fsGroup, json-server may run as another uid
+	return "umask 0002 && " + install
+}
+
+// describeLayout returns a short description of how db.json is stored, for status messages
+func describeLayout(layout *dataLayout) string {
+	if !layout.compressed {
+		return strings.Join(layout.configMaps, ", ")
+	}
+	return fmt.Sprintf("%s (gzip, %d ConfigMaps)", strings.Join(layout.configMaps, ", "), len(layout.configMaps))
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// Event reasons for changes to owned objects. Failures use the condition
+// reason of the failing step, e.g. InvalidJSON or ReconcileFailed.
+const (
+	eventReasonCreated = "Created"
+	eventReasonUpdated = "Updated"
+	eventReasonDeleted = "Deleted"
+)
+
+// recordOperation emits a Normal event for the create or update of an owned object
+func (r *JsonServerReconciler) recordOperation(jsonServer *examplecomv1.JsonServer, kind, name string, op controllerutil.OperationResult) {
+	switch op {
+	case controllerutil.OperationResultCreated:
+		r.event(jsonServer, corev1.EventTypeNormal, eventReasonCreated, "Created %s %s", kind, name)
+	case controllerutil.OperationResultNone:
+		// Unchanged objects would be reported on every reconcile
+	default:
+		r.event(jsonServer, corev1.EventTypeNormal, eventReasonUpdated, "Updated %s %s", kind, name)
+	}
+}
+
+// recordDeletion emits a Normal event for the deletion of an owned object
+func (r *JsonServerReconciler) recordDeletion(jsonServer *examplecomv1.JsonServer, obj client.Object) {
+	kind := "object"
+	if gvk, err := apiutil.GVKForObject(obj, r.Scheme); err == nil {
+		kind = gvk.Kind
+	}
+	r.event(jsonServer, corev1.EventTypeNormal, eventReasonDeleted, "Deleted %s %s", kind, obj.GetName())
+}
+
+// event emits an event on the JsonServer when a recorder is configured
+func (r *JsonServerReconciler) event(jsonServer *examplecomv1.JsonServer, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(jsonServer, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// reconcileExpiry sets the expiration status of a JsonServer with
+// spec.ttlSecondsAfterCreation or spec.expiresAt. It reports whether the
+// JsonServer has expired.
+func (r *JsonServerReconciler) reconcileExpiry(jsonServer *examplecomv1.JsonServer) bool {
+	expiry, ok := jsonServer.ExpirationTime(jsonServer.CreationTimestamp.Time)
+	if !ok {
+		jsonServer.Status.ExpirationTime = nil
+		jsonServer.Status.RemainingLifetime = ""
+		return false
+	}
+
+	remaining := expiry.Sub(r.now())
+	jsonServer.Status.ExpirationTime = &metav1.Time{Time: expiry}
+	jsonServer.Status.RemainingLifetime = duration.HumanDuration(remaining)
+	return remaining <= 0
+}
+
+// deleteExpired deletes an expired JsonServer. Owned objects are garbage collected.
+func (r *JsonServerReconciler) deleteExpired(ctx context.Context, jsonServer *examplecomv1.JsonServer) error {
+	log.FromContext(ctx).Info("Deleting expired JsonServer", "expirationTime", jsonServer.Status.ExpirationTime)
+
+	// The UID precondition guards against deleting a recreated JsonServer of the same name
+	err := r.Delete(ctx, jsonServer, client.Preconditions{UID: &jsonServer.UID})
+	return client.IgnoreNotFound(err)
+}
+
+// untilExpiryRefresh returns when the JsonServer should be reconciled again
+// to delete it on time and to keep status.remainingLifetime roughly current,
+// or zero without an expiration time
+func (r *JsonServerReconciler) untilExpiryRefresh(jsonServer *examplecomv1.JsonServer) time.Duration {
+	if jsonServer.Status.ExpirationTime == nil {
+		return 0
+	}
+
+	remaining := jsonServer.Status.ExpirationTime.Sub(r.now())
+	refresh := time.Hour
+	if remaining < 3*time.Hour {
+		refresh = time.Minute
+	}
+	return nextRequeue(max(remaining, time.Second), refresh)
+}
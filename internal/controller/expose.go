@@ -0,0 +1,273 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// reconcileExpose creates or updates the Ingress or HTTPRoute requested in
+// spec.expose and removes the one that is no longer wanted. It returns the
+// external URL, or an empty string when the JsonServer is not exposed.
+func (r *JsonServerReconciler) reconcileExpose(ctx context.Context, jsonServer *examplecomv1.JsonServer) (string, error) {
+	expose := jsonServer.Spec.Expose
+
+	// Clean up objects left over from an earlier spec
+	if expose == nil || expose.Type != examplecomv1.ExposeTypeIngress {
+		if err := r.deleteOwned(ctx, jsonServer, &networkingv1.Ingress{}); err != nil {
+			return "", err
+		}
+	}
+	if r.GatewayAPI && (expose == nil || expose.Type != examplecomv1.ExposeTypeHTTPRoute) {
+		if err := r.deleteOwned(ctx, jsonServer, &gatewayv1.HTTPRoute{}); err != nil {
+			return "", err
+		}
+	}
+
+	if expose == nil {
+		return "", nil
+	}
+
+	switch expose.Type {
+	case examplecomv1.ExposeTypeIngress:
+		if err := r.reconcileIngress(ctx, jsonServer); err != nil {
+			return "", err
+		}
+	case examplecomv1.ExposeTypeHTTPRoute:
+		if !r.GatewayAPI {
+			return "", fmt.Errorf("spec.expose.type HTTPRoute requires the Gateway API CRDs to be installed")
+		}
+		if err := r.reconcileHTTPRoute(ctx, jsonServer); err != nil {
+			return "", err
+		}
+	}
+
+	return expose.URL(jsonServer.Name, jsonServer.Namespace), nil
+}
+
+// reconcileIngress creates or updates the Ingress for the JsonServer
+func (r *JsonServerReconciler) reconcileIngress(ctx context.Context, jsonServer *examplecomv1.JsonServer) error {
+	expose := jsonServer.Spec.Expose
+	host := expose.RenderHost(jsonServer.Name, jsonServer.Namespace)
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jsonServer.Name,
+			Namespace: jsonServer.Namespace,
+		},
+	}
+
+	// Create or Update the Ingress
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, ingress, func() error {
+		// Set the owner reference
+		if err := controllerutil.SetControllerReference(jsonServer, ingress, r.Scheme); err != nil {
+			return err
+		}
+
+		// Set labels and annotations
+		ingress.Labels = map[string]string{
+			"app":                          jsonServer.Name,
+			"app.kubernetes.io/name":       jsonServer.Name,
+			"app.kubernetes.io/managed-by": "json-server-controller",
+		}
+		ingress.Annotations = expose.Annotations
+
+		// Set the spec
+		pathType := networkingv1.PathTypePrefix
+		ingress.Spec = networkingv1.IngressSpec{
+			IngressClassName: expose.IngressClassName,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     pathPrefix(expose),
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: jsonServer.Name,
+											Port: networkingv1.ServiceBackendPort{
+												Name: "http",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		if expose.TLSSecretName != "" {
+			ingress.Spec.TLS = []networkingv1.IngressTLS{
+				{
+					Hosts:      []string{host},
+					SecretName: expose.TLSSecretName,
+				},
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Ingress operation completed", "operation", op)
+	return nil
+}
+
+// reconcileHTTPRoute creates or updates the HTTPRoute for the JsonServer.
+// The path prefix is stripped before requests reach json-server.
+func (r *JsonServerReconciler) reconcileHTTPRoute(ctx context.Context, jsonServer *examplecomv1.JsonServer) error {
+	expose := jsonServer.Spec.Expose
+
+	route := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jsonServer.Name,
+			Namespace: jsonServer.Namespace,
+		},
+	}
+
+	// Create or Update the HTTPRoute
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, route, func() error {
+		// Set the owner reference
+		if err := controllerutil.SetControllerReference(jsonServer, route, r.Scheme); err != nil {
+			return err
+		}
+
+		// Set labels and annotations
+		route.Labels = map[string]string{
+			"app":                          jsonServer.Name,
+			"app.kubernetes.io/name":       jsonServer.Name,
+			"app.kubernetes.io/managed-by": "json-server-controller",
+		}
+		route.Annotations = expose.Annotations
+
+		parentRefs := make([]gatewayv1.ParentReference, 0, len(expose.ParentRefs))
+		for _, ref := range expose.ParentRefs {
+			parentRef := gatewayv1.ParentReference{
+				Name: gatewayv1.ObjectName(ref.Name),
+			}
+			if ref.Namespace != "" {
+				parentRef.Namespace = ptr.To(gatewayv1.Namespace(ref.Namespace))
+			}
+			if ref.SectionName != "" {
+				parentRef.SectionName = ptr.To(gatewayv1.SectionName(ref.SectionName))
+			}
+			parentRefs = append(parentRefs, parentRef)
+		}
+
+		rule := gatewayv1.HTTPRouteRule{
+			Matches: []gatewayv1.HTTPRouteMatch{
+				{
+					Path: &gatewayv1.HTTPPathMatch{
+						Type:  ptr.To(gatewayv1.PathMatchPathPrefix),
+						Value: ptr.To(pathPrefix(expose)),
+					},
+				},
+			},
+			BackendRefs: []gatewayv1.HTTPBackendRef{
+				{
+					BackendRef: gatewayv1.BackendRef{
+						BackendObjectReference: gatewayv1.BackendObjectReference{
+							Name: gatewayv1.ObjectName(jsonServer.Name),
+							Port: ptr.To(gatewayv1.PortNumber(servicePort(jsonServer))),
+						},
+					},
+				},
+			},
+		}
+		if pathPrefix(expose) != "/" {
+			rule.Filters = []gatewayv1.HTTPRouteFilter{
+				{
+					Type: gatewayv1.HTTPRouteFilterURLRewrite,
+					URLRewrite: &gatewayv1.HTTPURLRewriteFilter{
+						Path: &gatewayv1.HTTPPathModifier{
+							Type:               gatewayv1.PrefixMatchHTTPPathModifier,
+							ReplacePrefixMatch: ptr.To("/"),
+						},
+					},
+				},
+			}
+		}
+
+		// Set the spec
+		route.Spec = gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: parentRefs,
+			},
+			Hostnames: []gatewayv1.Hostname{
+				gatewayv1.Hostname(expose.RenderHost(jsonServer.Name, jsonServer.Namespace)),
+			},
+			Rules: []gatewayv1.HTTPRouteRule{rule},
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("HTTPRoute operation completed", "operation", op)
+	return nil
+}
+
+// deleteOwned deletes the object named after the JsonServer if it is controlled by it
+func (r *JsonServerReconciler) deleteOwned(ctx context.Context, jsonServer *examplecomv1.JsonServer, obj client.Object) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(jsonServer), obj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if !metav1.IsControlledBy(obj, jsonServer) {
+		return nil
+	}
+
+	if err := r.Delete(ctx, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.recordDeletion(jsonServer, obj)
+	return nil
+}
+
+// pathPrefix returns the exposed path prefix, defaulting to "/"
+func pathPrefix(expose *examplecomv1.ExposeSpec) string {
+	if expose.PathPrefix == "" {
+		return "/"
+	}
+	return expose.PathPrefix
+}
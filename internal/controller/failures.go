@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// classifyFailure returns the status.reason for a failed reconcile step and
+// whether the step should be retried. Retried failures are handed back to the
+// workqueue, which requeues them with exponential backoff.
+func classifyFailure(err error) (reason string, retry bool) {
+	switch {
+	case errors.IsConflict(err) || errors.IsAlreadyExists(err):
+		return examplecomv1.FailureReasonConflict, true
+	case errors.IsForbidden(err) && strings.Contains(failureMessage(err), "exceeded quota"):
+		return examplecomv1.FailureReasonQuotaExceeded, false
+	case errors.IsForbidden(err) || errors.IsUnauthorized(err):
+		return examplecomv1.FailureReasonForbidden, false
+	case errors.IsInvalid(err) || errors.IsBadRequest(err) || errors.IsRequestEntityTooLargeError(err):
+		return examplecomv1.FailureReasonInvalid, false
+	case !isAPIError(err) && !isNetworkError(err):
+		// Data the controller cannot render, e.g. a jsonConfig too large for its ConfigMaps
+		return examplecomv1.FailureReasonInvalid, false
+	default:
+		// Timeouts, throttling, unavailable API servers and network errors
+		return examplecomv1.FailureReasonTransient, true
+	}
+}
+
+// isAPIError reports whether the error was returned by the API server
+func isAPIError(err error) bool {
+	var status errors.APIStatus
+	return goerrors.As(err, &status)
+}
+
+// isNetworkError reports whether the API server could not be reached in time
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return goerrors.As(err, &netErr) || goerrors.Is(err, context.DeadlineExceeded) || goerrors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// failureMessage returns the message of the API error, or the error itself
+// for errors that did not come from the API server
+func failureMessage(err error) string {
+	var status errors.APIStatus
+	if goerrors.As(err, &status) && status.Status().Message != "" {
+		return status.Status().Message
+	}
+	return err.Error()
+}
+
+// updateStatusWithFailure records a failed reconcile step. The failure class
+// is stored in status.reason and the API error in the message. Conflicts and
+// transient failures are returned as errors so that the step is retried.
+func (r *JsonServerReconciler) updateStatusWithFailure(ctx context.Context, jsonServer *examplecomv1.JsonServer, conditionType, action string, err error) (ctrl.Result, error) {
+	reason, retry := classifyFailure(err)
+	message := fmt.Sprintf("Error: failed to %s: %s", action, failureMessage(err))
+
+	result, statusErr := r.setErrorStatus(ctx, jsonServer, conditionType, examplecomv1.ReasonReconcileFailed, reason, message)
+	if statusErr != nil {
+		return result, statusErr
+	}
+	if retry {
+		return ctrl.Result{}, fmt.Errorf("failed to %s: %w", action, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+const (
+	// activatorSinceAnnotation holds the time the Service of a JsonServer was
+	// pointed at the activator on the activator EndpointSlice
+	activatorSinceAnnotation = "example.com/activator-since"
+
+	// activatorDrainingAnnotation holds the time the Service of a JsonServer
+	// was pointed back at the pods on the activator EndpointSlice
+	activatorDrainingAnnotation = "example.com/activator-draining-since"
+
+	// activatorDrainPeriod is how long the activator keeps serving requests
+	// sent before kube-proxy and ingress controllers saw the pods again
+	activatorDrainPeriod = 30 * time.Second
+)
+
+// lastRequest returns the time of the last request recorded by the activator,
+// or the creation for JsonServers that never received one
+func lastRequest(jsonServer *examplecomv1.JsonServer) time.Time {
+	last := jsonServer.CreationTimestamp.Time
+	if at, err := time.Parse(time.RFC3339, jsonServer.Annotations[examplecomv1.LastRequestAtAnnotation]); err == nil && at.After(last) {
+		last = at
+	}
+	return last
+}
+
+// idleTimeout returns spec.idle.afterMinutes as a duration
+func idleTimeout(jsonServer *examplecomv1.JsonServer) time.Duration {
+	timeout := time.Duration(jsonServer.Spec.Idle.AfterMinutes) * time.Minute
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+	return timeout
+}
+
+// reconcileIdle sets status.idleSince when a JsonServer with spec.idle has
+// not received requests for spec.idle.afterMinutes. Requests served by the
+// pods directly are not seen by the activator, so once no request was
+// recorded for spec.idle.afterMinutes the traffic is routed through the
+// activator again, and the JsonServer only goes idle when the activator sees
+// no request for another spec.idle.afterMinutes. routedSince is the time the
+// traffic was pointed at the activator, zero while the pods serve it. It
+// returns the time until the next step, or zero when the JsonServer is idle
+// or has no idle policy.
+func (r *JsonServerReconciler) reconcileIdle(jsonServer *examplecomv1.JsonServer, routedSince time.Time) time.Duration {
+	if jsonServer.Spec.Idle == nil {
+		jsonServer.Status.IdleSince = nil
+		return 0
+	}
+
+	last := lastRequest(jsonServer)
+	timeout := idleTimeout(jsonServer)
+	now := r.now()
+	if now.Before(last.Add(timeout)) {
+		jsonServer.Status.IdleSince = nil
+		return last.Add(timeout).Sub(now)
+	}
+
+	// Route through the activator first, see routeThroughActivator
+	if routedSince.IsZero() {
+		return timeout
+	}
+	if routedSince.After(last) {
+		last = routedSince
+	}
+
+	idleAt := last.Add(timeout)
+	if now.Before(idleAt) {
+		return idleAt.Sub(now)
+	}
+
+	if jsonServer.Status.IdleSince == nil {
+		jsonServer.Status.IdleSince = &metav1.Time{Time: idleAt}
+	}
+	return 0
+}
+
+// untilIdle returns when a JsonServer with spec.idle that is awake should be
+// reconciled again to route it through the activator or scale it to zero.
+// Unlike reconcileIdle it does not look at the activator route, which makes
+// it usable when a reconcile failed before the route was known.
+func (r *JsonServerReconciler) untilIdle(jsonServer *examplecomv1.JsonServer) time.Duration {
+	if jsonServer.Spec.Idle == nil || jsonServer.Status.IdleSince != nil {
+		return 0
+	}
+	timeout := idleTimeout(jsonServer)
+	if until := lastRequest(jsonServer).Add(timeout).Sub(r.now()); until > 0 {
+		return until
+	}
+	return timeout
+}
+
+// routeThroughActivator reports whether the Service of a JsonServer with
+// spec.idle points at the activator. That is the case while it is scaled to
+// zero, until a pod is ready after waking up, and while no request was
+// recorded for spec.idle.afterMinutes. Otherwise the Service selects the pods.
+func (r *JsonServerReconciler) routeThroughActivator(jsonServer *examplecomv1.JsonServer, deployment *appsv1.Deployment) bool {
+	if jsonServer.Spec.Idle == nil {
+		return false
+	}
+	if jsonServer.Status.IdleSince != nil || deployment.Status.ReadyReplicas == 0 {
+		return true
+	}
+	return !r.now().Before(lastRequest(jsonServer).Add(idleTimeout(jsonServer)))
+}
+
+// activatorRoutedSince returns the time the Service of the JsonServer was
+// pointed at the activator, or zero while it selects the pods
+func (r *JsonServerReconciler) activatorRoutedSince(ctx context.Context, jsonServer *examplecomv1.JsonServer) (time.Time, error) {
+	if jsonServer.Spec.Idle == nil {
+		return time.Time{}, nil
+	}
+
+	slice := &discoveryv1.EndpointSlice{}
+	err := r.Get(ctx, types.NamespacedName{Name: activatorSliceName(jsonServer), Namespace: jsonServer.Namespace}, slice)
+	if err != nil {
+		return time.Time{}, client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(slice, jsonServer) {
+		return time.Time{}, nil
+	}
+	if _, draining := slice.Annotations[activatorDrainingAnnotation]; draining {
+		return time.Time{}, nil
+	}
+
+	// Slices written before the annotation existed count from now on
+	since, err := time.Parse(time.RFC3339, slice.Annotations[activatorSinceAnnotation])
+	if err != nil {
+		return r.now(), nil
+	}
+	return since, nil
+}
+
+// nextRequeue returns the shortest non-zero duration, or zero when all are zero
+func nextRequeue(durations ...time.Duration) time.Duration {
+	var next time.Duration
+	for _, d := range durations {
+		if d > 0 && (next == 0 || d < next) {
+			next = d
+		}
+	}
+	return next
+}
+
+// podsServiceName returns the name of the Service selecting the json-server
+// pods of a JsonServer with spec.idle, which the activator forwards requests to
+func podsServiceName(jsonServer *examplecomv1.JsonServer) string {
+	return fmt.Sprintf("%s-pods", jsonServer.Name)
+}
+
+// activatorSliceName returns the name of the EndpointSlice pointing the
+// Service of a JsonServer with spec.idle at the activator
+func activatorSliceName(jsonServer *examplecomv1.JsonServer) string {
+	return fmt.Sprintf("%s-activator", jsonServer.Name)
+}
+
+// reconcileActivatorRoute sends the traffic of a JsonServer with spec.idle
+// through the activator while viaActivator is set. The selector-less Service
+// of the JsonServer then gets an EndpointSlice with the activator address,
+// which drains once the Service selects the pods. A second Service selects
+// the pods for the activator and is removed without spec.idle. It returns
+// the time until a draining route can be removed, or zero.
+func (r *JsonServerReconciler) reconcileActivatorRoute(ctx context.Context, jsonServer *examplecomv1.JsonServer, viaActivator bool) (time.Duration, error) {
+	if jsonServer.Spec.Idle == nil {
+		// The pods Service is created first, so without it there is nothing to clean up
+		pods := &corev1.Service{}
+		err := r.Get(ctx, types.NamespacedName{Name: podsServiceName(jsonServer), Namespace: jsonServer.Namespace}, pods)
+		if err != nil {
+			return 0, client.IgnoreNotFound(err)
+		}
+		if err := r.deleteOwnedNamed(ctx, jsonServer, &discoveryv1.EndpointSlice{}, activatorSliceName(jsonServer)); err != nil {
+			return 0, err
+		}
+		return 0, r.deleteOwnedNamed(ctx, jsonServer, pods, podsServiceName(jsonServer))
+	}
+
+	labels := map[string]string{
+		"app":                          jsonServer.Name,
+		"app.kubernetes.io/name":       jsonServer.Name,
+		"app.kubernetes.io/managed-by": "json-server-controller",
+	}
+
+	// Create or Update the Service selecting the pods
+	pods := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podsServiceName(jsonServer),
+			Namespace: jsonServer.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, pods, func() error {
+		// Set the owner reference
+		if err := controllerutil.SetControllerReference(jsonServer, pods, r.Scheme); err != nil {
+			return err
+		}
+
+		pods.Labels = labels
+		pods.Spec.Type = corev1.ServiceTypeClusterIP
+		pods.Spec.Selector = map[string]string{
+			"app": jsonServer.Name,
+		}
+		pods.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "http",
+				Port:       servicePort(jsonServer),
+				TargetPort: intstr.FromString("http"),
+				Protocol:   corev1.ProtocolTCP,
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.FromContext(ctx).Info("Pods Service operation completed", "operation", op)
+
+	// The Service selects the pods, the activator only sees requests sent to it directly
+	if !viaActivator {
+		return r.drainActivatorSlice(ctx, jsonServer)
+	}
+
+	// Create or Update the EndpointSlice pointing at the activator
+	addressType := discoveryv1.AddressTypeIPv4
+	if ip := net.ParseIP(r.ActivatorAddress); ip != nil && ip.To4() == nil {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      activatorSliceName(jsonServer),
+			Namespace: jsonServer.Namespace,
+		},
+		AddressType: addressType,
+	}
+	op, err = controllerutil.CreateOrUpdate(ctx, r.Client, slice, func() error {
+		// Set the owner reference
+		if err := controllerutil.SetControllerReference(jsonServer, slice, r.Scheme); err != nil {
+			return err
+		}
+
+		slice.Labels = map[string]string{
+			"app":                          jsonServer.Name,
+			"app.kubernetes.io/managed-by": "json-server-controller",
+			discoveryv1.LabelServiceName:   jsonServer.Name,
+			discoveryv1.LabelManagedBy:     "json-server-controller",
+		}
+		_, draining := slice.Annotations[activatorDrainingAnnotation]
+		if _, ok := slice.Annotations[activatorSinceAnnotation]; !ok || draining {
+			slice.Annotations = map[string]string{
+				activatorSinceAnnotation: r.now().UTC().Format(time.RFC3339),
+			}
+		}
+		slice.Ports = []discoveryv1.EndpointPort{
+			{
+				Name:     ptr.To("http"),
+				Port:     ptr.To(r.ActivatorPort),
+				Protocol: ptr.To(corev1.ProtocolTCP),
+			},
+		}
+		slice.Endpoints = []discoveryv1.Endpoint{
+			{
+				Addresses: []string{r.ActivatorAddress},
+				Conditions: discoveryv1.EndpointConditions{
+					Ready: ptr.To(true),
+				},
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.FromContext(ctx).Info("Activator EndpointSlice operation completed", "operation", op)
+
+	return 0, nil
+}
+
+// drainActivatorSlice marks the activator endpoint not ready once the Service
+// selects the pods again, so that kube-proxy only uses the pods while the
+// activator still serves requests sent before the change. The EndpointSlice
+// is deleted after activatorDrainPeriod. It returns the time until then.
+func (r *JsonServerReconciler) drainActivatorSlice(ctx context.Context, jsonServer *examplecomv1.JsonServer) (time.Duration, error) {
+	slice := &discoveryv1.EndpointSlice{}
+	err := r.Get(ctx, types.NamespacedName{Name: activatorSliceName(jsonServer), Namespace: jsonServer.Namespace}, slice)
+	if err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(slice, jsonServer) {
+		return 0, nil
+	}
+
+	since, err := time.Parse(time.RFC3339, slice.Annotations[activatorDrainingAnnotation])
+	if err != nil {
+		if slice.Annotations == nil {
+			slice.Annotations = map[string]string{}
+		}
+		slice.Annotations[activatorDrainingAnnotation] = r.now().UTC().Format(time.RFC3339)
+		for i := range slice.Endpoints {
+			slice.Endpoints[i].Conditions.Ready = ptr.To(false)
+		}
+		if err := r.Update(ctx, slice); err != nil {
+			return 0, err
+		}
+		log.FromContext(ctx).Info("Activator EndpointSlice draining")
+		return activatorDrainPeriod, nil
+	}
+
+	if remaining := since.Add(activatorDrainPeriod).Sub(r.now()); remaining > 0 {
+		return remaining, nil
+	}
+	if err := r.Delete(ctx, slice); err != nil {
+		return 0, client.IgnoreNotFound(err)
+	}
+	r.recordDeletion(jsonServer, slice)
+	return 0, nil
+}
+
+// deleteOwnedNamed deletes the named object if it is controlled by the JsonServer
+func (r *JsonServerReconciler) deleteOwnedNamed(ctx context.Context, jsonServer *examplecomv1.JsonServer, obj client.Object, name string) error {
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: jsonServer.Namespace}, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if !metav1.IsControlledBy(obj, jsonServer) {
+		return nil
+	}
+
+	if err := r.Delete(ctx, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.recordDeletion(jsonServer, obj)
+	return nil
+}
@@ -18,28 +18,98 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
 )
 
+const (
+	// defaultPort is the port json-server listens on when spec.service.port is not set
+	defaultPort int32 = 3000
+
+	// DefaultImage is the json-server image used when neither the JsonServer nor the controller sets one
+	DefaultImage = "backplane/json-server"
+
+	// configHashAnnotation is set on the pod template so data changes roll the Deployment
+	configHashAnnotation = "example.com/config-hash"
+
+	// DefaultSeedImage is used by the init container that places db.json into
+	// the data volume when the controller does not set one
+	DefaultSeedImage = "busybox:1.36"
+)
+
+// defaultStorageSize is the size of the PersistentVolumeClaim when spec.storage.size is not set
+var defaultStorageSize = resource.MustParse("1Gi")
+
 // JsonServerReconciler reconciles a JsonServer object
 type JsonServerReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// DefaultImage is the json-server image used when spec.image is empty
+	DefaultImage string
+
+	// SeedImage runs the init container that seeds persistent volumes and
+	// unpacks compressed data, defaults to DefaultSeedImage
+	SeedImage string
+
+	// GoRuntimeImage is the controller image, which runs JsonServers with
+	// spec.runtime go. They fail to reconcile while it is empty, unless they set spec.image
+	GoRuntimeImage string
+
+	// GatewayAPI enables HTTPRoute support. Set when the Gateway API CRDs are installed
+	GatewayAPI bool
+
+	// Clock is used for reset and idle schedules, defaults to the real clock
+	Clock clock.PassiveClock
+
+	// ActivatorAddress is the pod IP the activator is reachable at. JsonServers
+	// with spec.idle fail to reconcile while it is empty
+	ActivatorAddress string
+
+	// ActivatorPort is the port the activator listens on
+	ActivatorPort int32
+
+	// Recorder emits events on the JsonServer for every reconcile outcome
+	Recorder record.EventRecorder
+
+	// APIReader reads referenced Secrets and the ReplicaSets of a rollout from
+	// the API server, so that they are not cached. Defaults to the client
+	APIReader client.Reader
+
+	// rollouts holds the rolloutStart of JsonServers whose spec changed
+	rollouts sync.Map
 }
 
 // +kubebuilder:rbac:groups=example.com,resources=jsonservers,verbs=get;list;watch;create;update;patch;delete
@@ -47,8 +117,15 @@ type JsonServerReconciler struct {
 // +kubebuilder:rbac:groups=example.com,resources=jsonservers/finalizers,verbs=update
 // +kubebuilder:rbac:groups=example.com,resources=jsonservers/scale,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=list
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -62,6 +139,7 @@ func (r *JsonServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		if errors.IsNotFound(err) {
 			// Object not found, return. Created objects are automatically garbage collected.
 			logger.Info("JsonServer resource not found. Ignoring since object must be deleted")
+			r.forgetMetrics(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -69,69 +147,322 @@ func (r *JsonServerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
+	// Delete the JsonServer once spec.ttlSecondsAfterCreation or spec.expiresAt has passed
+	if r.reconcileExpiry(jsonServer) {
+		if err := r.deleteExpired(ctx, jsonServer); err != nil {
+			logger.Error(err, "Failed to delete expired JsonServer")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	r.trackRollout(jsonServer)
+
+	// Load JSON config from spec.jsonConfig, the referenced ConfigMap or Secret, or a snapshot
+	jsonConfig, err := r.resolveJsonConfig(ctx, jsonServer)
+	if err != nil {
+		var keyErr *errSourceKeyNotFound
+		var snapshotErr *errSnapshotNotReady
+		switch {
+		case errors.IsNotFound(err) || goerrors.As(err, &keyErr):
+			// The source watch triggers a new reconcile once the object appears
+			return r.updateStatusWithError(ctx, jsonServer, examplecomv1.ConditionConfigValid, examplecomv1.ReasonSourceNotFound, fmt.Sprintf("Error: %s not found: %v", sourceField(jsonServer), err))
+		case goerrors.As(err, &snapshotErr):
+			return r.updateStatusWithError(ctx, jsonServer, examplecomv1.ConditionConfigValid, examplecomv1.ReasonSnapshotNotReady, fmt.Sprintf("Error: %v", err))
+		}
+		logger.Error(err, "Failed to load data", "field", sourceField(jsonServer))
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionConfigValid, "load data", err)
+	}
+
 	// Validate JSON config
 	var js interface{}
-	if err := json.Unmarshal([]byte(jsonServer.Spec.JsonConfig), &js); err != nil {
+	if err := json.Unmarshal([]byte(jsonConfig), &js); err != nil {
 		// Update status with error
-		return r.updateStatusWithError(ctx, jsonServer, "Error: spec.jsonConfig is not a valid json object")
+		message := "Error: spec.jsonConfig is not a valid json object"
+		if sourceField(jsonServer) != "spec.jsonConfig" {
+			message = fmt.Sprintf("Error: %s does not contain a valid json object", sourceField(jsonServer))
+		}
+		return r.updateStatusWithError(ctx, jsonServer, examplecomv1.ConditionConfigValid, examplecomv1.ReasonInvalidJSON, message)
+	}
+	setCondition(jsonServer, examplecomv1.ConditionConfigValid, metav1.ConditionTrue, examplecomv1.ReasonValidJSON, fmt.Sprintf("%s is valid JSON", sourceField(jsonServer)))
+	jsonServer.Status.Resources = summarizeResources(jsonConfig)
+	configSizeBytes.WithLabelValues(jsonServer.Namespace, jsonServer.Name).Set(float64(len(jsonConfig)))
+
+	// Compress and split large data so that it fits into ConfigMaps
+	start := time.Now()
+	payload, err := renderPayload(jsonServer, jsonConfig)
+	if err != nil {
+		logger.Error(err, "Failed to render jsonConfig")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionConfigMapReady, "render jsonConfig", err)
 	}
 
-	// Create or update ConfigMap
-	configMap, err := r.reconcileConfigMap(ctx, jsonServer)
+	// Create the immutable ConfigMaps of the current data revision
+	layout, err := r.reconcileConfigMap(ctx, jsonServer, payload, hashConfigData(configFiles(jsonConfig, payload.routes)))
+	observeStep(stepConfigMap, start)
 	if err != nil {
 		logger.Error(err, "Failed to reconcile ConfigMap")
-		return r.updateStatusWithError(ctx, jsonServer, "Error: unexpected failure")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionConfigMapReady, "reconcile ConfigMap", err)
+	}
+	logger.Info("ConfigMap reconciled", "ConfigMap.Namespace", jsonServer.Namespace, "ConfigMap.Name", layout.configMaps[0])
+	current := layout.configHash
+
+	// Serve an earlier revision when spec.rollbackTo pins one
+	if jsonServer.Spec.RollbackTo != "" && jsonServer.Spec.RollbackTo != current {
+		var served string
+		layout, served, err = r.loadRevision(ctx, jsonServer, jsonServer.Spec.RollbackTo)
+		if err != nil {
+			var notFound *errRevisionNotFound
+			if goerrors.As(err, &notFound) {
+				return r.updateStatusWithError(ctx, jsonServer, examplecomv1.ConditionConfigMapReady, examplecomv1.ReasonRevisionNotFound, fmt.Sprintf("Error: spec.rollbackTo: %v", err))
+			}
+			logger.Error(err, "Failed to load revision", "Revision", jsonServer.Spec.RollbackTo)
+			return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionConfigMapReady, "load revision", err)
+		}
+		jsonServer.Status.Resources = summarizeResources(served)
+		setCondition(jsonServer, examplecomv1.ConditionConfigMapReady, metav1.ConditionTrue, examplecomv1.ReasonRolledBack, fmt.Sprintf("Rolled back to revision %s in ConfigMap %s", layout.configHash, describeLayout(layout)))
+	} else {
+		setCondition(jsonServer, examplecomv1.ConditionConfigMapReady, metav1.ConditionTrue, examplecomv1.ReasonReconciled, fmt.Sprintf("ConfigMap %s is up to date", describeLayout(layout)))
+	}
+	jsonServer.Status.ConfigHash = layout.configHash
+
+	// Copy the served revision into the ConfigMap mounted with the InPlace reload strategy
+	if err := r.reconcileCurrentConfigMap(ctx, jsonServer, layout); err != nil {
+		logger.Error(err, "Failed to reconcile current ConfigMap")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionConfigMapReady, "reconcile current ConfigMap", err)
+	}
+
+	// Create or update PersistentVolumeClaim when running in Persistent mode
+	if isPersistent(jsonServer) {
+		start = time.Now()
+		pvc, err := r.reconcilePersistentVolumeClaim(ctx, jsonServer)
+		observeStep(stepStorage, start)
+		if err != nil {
+			logger.Error(err, "Failed to reconcile PersistentVolumeClaim")
+			return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionStorageReady, "reconcile PersistentVolumeClaim", err)
+		}
+		logger.Info("PersistentVolumeClaim reconciled", "PersistentVolumeClaim.Namespace", pvc.Namespace, "PersistentVolumeClaim.Name", pvc.Name)
+		setCondition(jsonServer, examplecomv1.ConditionStorageReady, metav1.ConditionTrue, examplecomv1.ReasonReconciled, fmt.Sprintf("PersistentVolumeClaim %s is up to date", pvc.Name))
+	} else {
+		meta.RemoveStatusCondition(&jsonServer.Status.Conditions, examplecomv1.ConditionStorageReady)
+	}
+
+	// Reset the data when requested or scheduled
+	nextReset, err := r.reconcileReset(ctx, jsonServer)
+	if err != nil {
+		return r.updateStatusWithError(ctx, jsonServer, examplecomv1.ConditionReady, examplecomv1.ReasonInvalidSchedule, fmt.Sprintf("Error: %v", err))
+	}
+
+	// Scale to zero after spec.idle.afterMinutes without requests
+	if jsonServer.Spec.Idle != nil && r.ActivatorAddress == "" {
+		return r.updateStatusWithError(ctx, jsonServer, examplecomv1.ConditionServiceReady, examplecomv1.ReasonActivatorDisabled, "Error: spec.idle requires the activator, start the controller with --activator-address")
+	}
+	routedSince, err := r.activatorRoutedSince(ctx, jsonServer)
+	if err != nil {
+		logger.Error(err, "Failed to get activator route")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionServiceReady, "get activator route", err)
+	}
+	untilIdle := r.reconcileIdle(jsonServer, routedSince)
+
+	// The go runtime runs the controller image unless spec.image is set
+	if isGoRuntime(jsonServer) && jsonServer.Spec.Image == "" && r.GoRuntimeImage == "" {
+		return r.updateStatusWithError(ctx, jsonServer, examplecomv1.ConditionDeploymentAvailable, examplecomv1.ReasonGoRuntimeUnavailable, "Error: spec.runtime go requires the controller image, start the controller with --go-runtime-image")
 	}
-	logger.Info("ConfigMap reconciled", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
 
 	// Create or update Deployment
-	deployment, err := r.reconcileDeployment(ctx, jsonServer)
+	start = time.Now()
+	deployment, err := r.reconcileDeployment(ctx, jsonServer, layout)
+	observeStep(stepDeployment, start)
 	if err != nil {
 		logger.Error(err, "Failed to reconcile Deployment")
-		return r.updateStatusWithError(ctx, jsonServer, "Error: unexpected failure")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionDeploymentAvailable, "reconcile Deployment", err)
 	}
 	logger.Info("Deployment reconciled", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
 
+	// Remove data revisions beyond spec.revisionHistoryLimit once the Deployment no longer needs them
+	mounted, err := r.rolloutConfigMaps(ctx, jsonServer, deployment)
+	if err != nil {
+		logger.Error(err, "Failed to list ReplicaSets")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionConfigMapReady, "list ReplicaSets", err)
+	}
+	revisions, err := r.pruneRevisions(ctx, jsonServer, layout.current, mounted, current, layout.configHash)
+	if err != nil {
+		logger.Error(err, "Failed to prune ConfigMap revisions")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionConfigMapReady, "prune ConfigMap revisions", err)
+	}
+	jsonServer.Status.Revisions = revisions
+
 	// Create or update Service
-	service, err := r.reconcileService(ctx, jsonServer)
+	viaActivator := r.routeThroughActivator(jsonServer, deployment)
+	start = time.Now()
+	service, err := r.reconcileService(ctx, jsonServer, viaActivator)
+	observeStep(stepService, start)
 	if err != nil {
 		logger.Error(err, "Failed to reconcile Service")
-		return r.updateStatusWithError(ctx, jsonServer, "Error: unexpected failure")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionServiceReady, "reconcile Service", err)
 	}
 	logger.Info("Service reconciled", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
 
-	// Update status to Synced
-	return r.updateStatusSuccess(ctx, jsonServer)
+	// Route the traffic of JsonServers with spec.idle through the activator while they sleep
+	untilDrained, err := r.reconcileActivatorRoute(ctx, jsonServer, viaActivator)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile activator route")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionServiceReady, "reconcile activator route", err)
+	}
+	setCondition(jsonServer, examplecomv1.ConditionServiceReady, metav1.ConditionTrue, examplecomv1.ReasonReconciled, fmt.Sprintf("Service %s is up to date", service.Name))
+	jsonServer.Status.InternalURL = internalURL(jsonServer)
+
+	// Create, update or remove the Ingress or HTTPRoute
+	start = time.Now()
+	externalURL, err := r.reconcileExpose(ctx, jsonServer)
+	observeStep(stepExpose, start)
+	if err != nil {
+		logger.Error(err, "Failed to reconcile exposure")
+		return r.updateStatusWithFailure(ctx, jsonServer, examplecomv1.ConditionExposed, "reconcile exposure", err)
+	}
+	jsonServer.Status.ExternalURL = externalURL
+	if jsonServer.Spec.Expose != nil {
+		logger.Info("Exposure reconciled", "Type", jsonServer.Spec.Expose.Type, "URL", externalURL)
+		setCondition(jsonServer, examplecomv1.ConditionExposed, metav1.ConditionTrue, examplecomv1.ReasonReconciled, fmt.Sprintf("Exposed at %s", externalURL))
+	} else {
+		meta.RemoveStatusCondition(&jsonServer.Status.Conditions, examplecomv1.ConditionExposed)
+	}
+
+	// Update status from the Deployment rollout
+	result, err := r.updateStatusSuccess(ctx, jsonServer, deployment)
+	if err == nil {
+		result.RequeueAfter = nextRequeue(nextReset, untilIdle, untilDrained, r.untilExpiryRefresh(jsonServer))
+	}
+	return result, err
 }
 
-// reconcileConfigMap creates or updates the ConfigMap for the JsonServer
-func (r *JsonServerReconciler) reconcileConfigMap(ctx context.Context, jsonServer *examplecomv1.JsonServer) (*corev1.ConfigMap, error) {
-	configMapName := fmt.Sprintf("%s-config", jsonServer.Name)
+// reconcileConfigMap creates the immutable ConfigMaps holding a data revision
+// and makes it the newest revision. Revisions are named after the hash of
+// their data, so unchanged data maps onto the existing ConfigMaps.
+func (r *JsonServerReconciler) reconcileConfigMap(ctx context.Context, jsonServer *examplecomv1.JsonServer, payload *configPayload, configHash string) (*dataLayout, error) {
+	// Further chunks go first, so that an existing main ConfigMap means a complete revision
+	shards, err := r.reconcileShards(ctx, jsonServer, configHash, payload)
+	if err != nil {
+		return nil, err
+	}
 
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      configMapName,
+			Name:      revisionConfigMapName(jsonServer, configHash),
 			Namespace: jsonServer.Namespace,
+			Labels:    revisionLabels(jsonServer, configHash),
 		},
 	}
 
-	// Create or Update the ConfigMap
-	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, configMap, func() error {
+	// Set the data. Referenced sources are mounted directly and not copied,
+	// large data is stored compressed with further chunks in shard ConfigMaps
+	switch {
+	case payload.compressed():
+		configMap.BinaryData = map[string][]byte{
+			chunkKey(0): payload.chunks[0],
+		}
+	case !hasSourceRef(jsonServer):
+		configMap.Data = map[string]string{
+			"db.json": payload.plain,
+		}
+	}
+	if payload.routes != "" {
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data["routes.json"] = payload.routes
+	}
+
+	// Find the newest revision number
+	configMaps, err := r.listConfigMaps(ctx, jsonServer)
+	if err != nil {
+		return nil, err
+	}
+	var latest int64
+	for i := range configMaps {
+		if n := revisionNumber(&configMaps[i]); n > latest && configMaps[i].Name != configMap.Name {
+			latest = n
+		}
+	}
+	configMap.Annotations = map[string]string{
+		revisionAnnotation: strconv.FormatInt(latest+1, 10),
+	}
+
+	op, err := r.createImmutable(ctx, jsonServer, configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// Data seen before becomes the newest revision again
+	if op == controllerutil.OperationResultNone && revisionNumber(configMap) <= latest {
+		if configMap.Annotations == nil {
+			configMap.Annotations = map[string]string{}
+		}
+		configMap.Annotations[revisionAnnotation] = strconv.FormatInt(latest+1, 10)
+		if err := r.Update(ctx, configMap); err != nil {
+			return nil, err
+		}
+		op = controllerutil.OperationResultUpdated
+	}
+
+	log.FromContext(ctx).Info("ConfigMap operation completed", "operation", op)
+	r.recordOperation(jsonServer, "ConfigMap", configMap.Name, op)
+	return &dataLayout{
+		configHash: configHash,
+		configMaps: append([]string{configMap.Name}, shards...),
+		compressed: payload.compressed(),
+		routes:     payload.routes != "",
+		files:      configMap.Data,
+	}, nil
+}
+
+// reconcilePersistentVolumeClaim creates or updates the PersistentVolumeClaim holding the json-server data
+func (r *JsonServerReconciler) reconcilePersistentVolumeClaim(ctx context.Context, jsonServer *examplecomv1.JsonServer) (*corev1.PersistentVolumeClaim, error) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dataClaimName(jsonServer),
+			Namespace: jsonServer.Namespace,
+		},
+	}
+
+	size := defaultStorageSize
+	if jsonServer.Spec.Storage.Size != nil {
+		size = *jsonServer.Spec.Storage.Size
+	}
+
+	// Create or Update the PersistentVolumeClaim
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, pvc, func() error {
 		// Set the owner reference
-		if err := controllerutil.SetControllerReference(jsonServer, configMap, r.Scheme); err != nil {
+		if err := controllerutil.SetControllerReference(jsonServer, pvc, r.Scheme); err != nil {
 			return err
 		}
 
 		// Set labels
-		configMap.Labels = map[string]string{
+		pvc.Labels = map[string]string{
 			"app":                          jsonServer.Name,
 			"app.kubernetes.io/name":       jsonServer.Name,
 			"app.kubernetes.io/managed-by": "json-server-controller",
 		}
 
-		// Set the data
-		configMap.Data = map[string]string{
-			"db.json": jsonServer.Spec.JsonConfig,
+		// Most of the claim spec is immutable, so it is only set on creation
+		if pvc.CreationTimestamp.IsZero() {
+			pvc.Spec = corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: jsonServer.Spec.Storage.StorageClassName,
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: size,
+					},
+				},
+			}
+			return nil
+		}
+
+		// Existing claims can only grow
+		current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		if size.Cmp(current) > 0 {
+			if pvc.Spec.Resources.Requests == nil {
+				pvc.Spec.Resources.Requests = corev1.ResourceList{}
+			}
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
 		}
 
 		return nil
@@ -141,14 +472,12 @@ func (r *JsonServerReconciler) reconcileConfigMap(ctx context.Context, jsonServe
 		return nil, err
 	}
 
-	log.FromContext(ctx).Info("ConfigMap operation completed", "operation", op)
-	return configMap, nil
+	log.FromContext(ctx).Info("PersistentVolumeClaim operation completed", "operation", op)
+	return pvc, nil
 }
 
 // reconcileDeployment creates or updates the Deployment for the JsonServer
-func (r *JsonServerReconciler) reconcileDeployment(ctx context.Context, jsonServer *examplecomv1.JsonServer) (*appsv1.Deployment, error) {
-	configMapName := fmt.Sprintf("%s-config", jsonServer.Name)
-
+func (r *JsonServerReconciler) reconcileDeployment(ctx context.Context, jsonServer *examplecomv1.JsonServer, layout *dataLayout) (*appsv1.Deployment, error) {
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      jsonServer.Name,
@@ -173,7 +502,8 @@ func (r *JsonServerReconciler) reconcileDeployment(ctx context.Context, jsonServ
 
 		// Set the spec
 		deployment.Spec = appsv1.DeploymentSpec{
-			Replicas: &jsonServer.Spec.Replicas,
+			Replicas: ptr.To(desiredReplicas(jsonServer)),
+			Strategy: deploymentStrategy(jsonServer),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
 					"app": jsonServer.Name,
@@ -184,44 +514,39 @@ func (r *JsonServerReconciler) reconcileDeployment(ctx context.Context, jsonServ
 					Labels: map[string]string{
 						"app": jsonServer.Name,
 					},
+					Annotations: podAnnotations(jsonServer, layout),
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
-							Name:  "json-server",
-							Image: "backplane/json-server",
-							Args:  []string{"/data/db.json"},
+							Name:            "json-server",
+							Image:           r.imageFor(jsonServer),
+							ImagePullPolicy: jsonServer.Spec.ImagePullPolicy,
+							Command:         containerCommand(jsonServer),
+							Args:            containerArgs(jsonServer, layout),
 							Ports: []corev1.ContainerPort{
 								{
-									ContainerPort: 3000,
+									ContainerPort: servicePort(jsonServer),
 									Name:          "http",
 									Protocol:      corev1.ProtocolTCP,
 								},
 							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "json-config",
-									MountPath: "/data",
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: "json-config",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: configMapName,
-									},
-								},
-							},
+							VolumeMounts: dataVolumeMounts(jsonServer, layout),
 						},
 					},
+					InitContainers:   seedInitContainers(jsonServer, layout, r.seedImage()),
+					Volumes:          dataVolumes(jsonServer, layout),
+					ImagePullSecrets: jsonServer.Spec.ImagePullSecrets,
 				},
 			},
 		}
 
+		// Add health probes to the json-server container
+		applyProbes(&deployment.Spec.Template.Spec.Containers[0], jsonServer)
+
+		// Merge user overrides and secure defaults into the pod template
+		applyPodTemplate(&deployment.Spec.Template, jsonServer)
+
 		return nil
 	})
 
@@ -230,11 +555,271 @@ func (r *JsonServerReconciler) reconcileDeployment(ctx context.Context, jsonServ
 	}
 
 	log.FromContext(ctx).Info("Deployment operation completed", "operation", op)
+	r.recordOperation(jsonServer, "Deployment", deployment.Name, op)
 	return deployment, nil
 }
 
+// imageFor returns the json-server image for the JsonServer, preferring
+// spec.image over the controller-wide default
+func (r *JsonServerReconciler) imageFor(jsonServer *examplecomv1.JsonServer) string {
+	if jsonServer.Spec.Image != "" {
+		return jsonServer.Spec.Image
+	}
+	if isGoRuntime(jsonServer) {
+		return r.GoRuntimeImage
+	}
+	if r.DefaultImage != "" {
+		return r.DefaultImage
+	}
+	return DefaultImage
+}
+
+// seedImage returns the image of the init container seeding the data volume
+func (r *JsonServerReconciler) seedImage() string {
+	if r.SeedImage != "" {
+		return r.SeedImage
+	}
+	return DefaultSeedImage
+}
+
+// podAnnotations returns the controller-owned pod template annotations.
+// With the Restart strategy the config hash is included so that every data
+// change produces a new pod template and a rollout. Compressed data is
+// unpacked at pod start, so it always needs a restart. The time of the last
+// reset restarts the pods on every reset.
+func podAnnotations(jsonServer *examplecomv1.JsonServer, layout *dataLayout) map[string]string {
+	annotations := map[string]string{}
+	if jsonServer.Spec.ReloadStrategy != examplecomv1.ReloadStrategyInPlace || layout.compressed {
+		annotations[configHashAnnotation] = layout.configHash
+	}
+	if token := resetToken(jsonServer); token != "" {
+		annotations[resetAtAnnotation] = token
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// desiredReplicas returns the replica count of the Deployment, zero while suspended or idle
+func desiredReplicas(jsonServer *examplecomv1.JsonServer) int32 {
+	if jsonServer.Spec.Suspend || jsonServer.Status.IdleSince != nil {
+		return 0
+	}
+	return jsonServer.Spec.Replicas
+}
+
+// isGoRuntime reports whether the JsonServer runs the Go implementation of json-server
+func isGoRuntime(jsonServer *examplecomv1.JsonServer) bool {
+	return jsonServer.Spec.Runtime == examplecomv1.RuntimeGo
+}
+
+// containerCommand returns the entrypoint of the json-server container. The
+// node image keeps its own, the go runtime is the serve mode of the manager
+func containerCommand(jsonServer *examplecomv1.JsonServer) []string {
+	if isGoRuntime(jsonServer) {
+		return []string{"/manager", "serve"}
+	}
+	return nil
+}
+
+// containerArgs returns the json-server command line
+func containerArgs(jsonServer *examplecomv1.JsonServer, layout *dataLayout) []string {
+	args := []string{"--port", fmt.Sprint(servicePort(jsonServer))}
+	if jsonServer.Spec.ReloadStrategy == examplecomv1.ReloadStrategyInPlace {
+		args = append(args, "--watch")
+	}
+	if layout.routes {
+		args = append(args, "--routes", "/data/routes.json")
+	}
+	// Flags of the go runtime must come before the data file
+	if isGoRuntime(jsonServer) {
+		return append(args, "/data/db.json")
+	}
+	return append([]string{"/data/db.json"}, args...)
+}
+
+// configFiles returns every file mounted into the json-server data directory,
+// including db.json when it comes from a referenced source
+func configFiles(jsonConfig, routes string) map[string]string {
+	files := map[string]string{
+		"db.json": jsonConfig,
+	}
+	if routes != "" {
+		files["routes.json"] = routes
+	}
+	return files
+}
+
+// hashConfigData returns a short, stable hash of the ConfigMap data
+func hashConfigData(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(data[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// isPersistent reports whether the JsonServer keeps its data on a PersistentVolumeClaim
+func isPersistent(jsonServer *examplecomv1.JsonServer) bool {
+	return jsonServer.Spec.Storage != nil && jsonServer.Spec.Storage.Mode == examplecomv1.StorageModePersistent
+}
+
+// dataClaimName returns the name of the PersistentVolumeClaim used in Persistent mode
+func dataClaimName(jsonServer *examplecomv1.JsonServer) string {
+	return fmt.Sprintf("%s-data", jsonServer.Name)
+}
+
+// deploymentStrategy returns the rollout strategy for the Deployment.
+// A ReadWriteOnce claim cannot be attached to old and new pods at once, so
+// Persistent mode replaces pods instead of rolling them.
+func deploymentStrategy(jsonServer *examplecomv1.JsonServer) appsv1.DeploymentStrategy {
+	if isPersistent(jsonServer) {
+		return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+	return appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+}
+
+// usesDataVolume reports whether /data is a writable volume filled by an
+// init container instead of the mounted configuration
+func usesDataVolume(jsonServer *examplecomv1.JsonServer, layout *dataLayout) bool {
+	return isPersistent(jsonServer) || layout.compressed
+}
+
+// dataVolumes returns the pod volumes for the JsonServer. With the InPlace
+// reload strategy the mutable current ConfigMap is mounted instead of the revision.
+func dataVolumes(jsonServer *examplecomv1.JsonServer, layout *dataLayout) []corev1.Volume {
+	configMaps := layout.configMaps
+	if layout.current != "" {
+		configMaps = []string{layout.current}
+	}
+	configVolume := corev1.VolumeSource{
+		ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{
+				Name: configMaps[0],
+			},
+		},
+	}
+
+	// Shards and referenced sources are projected next to the generated ConfigMap
+	projection := sourceVolumeProjection(jsonServer)
+	if projection != nil || len(configMaps) > 1 {
+		sources := make([]corev1.VolumeProjection, 0, len(configMaps)+1)
+		for _, name := range configMaps {
+			sources = append(sources, corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: name,
+					},
+				},
+			})
+		}
+		if projection != nil {
+			sources = append(sources, *projection)
+		}
+		configVolume = corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: sources,
+			},
+		}
+	}
+
+	volumes := []corev1.Volume{
+		{
+			Name:         "json-config",
+			VolumeSource: configVolume,
+		},
+	}
+
+	switch {
+	case isPersistent(jsonServer):
+		volumes = append(volumes, corev1.Volume{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: dataClaimName(jsonServer),
+				},
+			},
+		})
+	case usesDataVolume(jsonServer, layout):
+		volumes = append(volumes, corev1.Volume{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	return volumes
+}
+
+// dataVolumeMounts returns the volume mounts of the json-server container
+func dataVolumeMounts(jsonServer *examplecomv1.JsonServer, layout *dataLayout) []corev1.VolumeMount {
+	if usesDataVolume(jsonServer, layout) {
+		return []corev1.VolumeMount{
+			{
+				Name:      "data",
+				MountPath: "/data",
+			},
+		}
+	}
+
+	return []corev1.VolumeMount{
+		{
+			Name:      "json-config",
+			MountPath: "/data",
+		},
+	}
+}
+
+// seedInitContainers returns the init container that places db.json into the
+// data volume, unpacking compressed data. On a persistent volume existing data
+// is left untouched so that changes made through the REST API survive
+// restarts, until the data is reset. spec.imagePullSecrets are set on the
+// pod, so they also apply to the seed image.
+func seedInitContainers(jsonServer *examplecomv1.JsonServer, layout *dataLayout, image string) []corev1.Container {
+	if !usesDataVolume(jsonServer, layout) {
+		return nil
+	}
+
+	return []corev1.Container{
+		{
+			Name:    "seed-data",
+			Image:   image,
+			Command: []string{"sh", "-c", unpackScript(jsonServer, layout)},
+			Env: []corev1.EnvVar{
+				{
+					Name:  "RESET_TOKEN",
+					Value: resetToken(jsonServer),
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "json-config",
+					MountPath: "/seed",
+					ReadOnly:  true,
+				},
+				{
+					Name:      "data",
+					MountPath: "/data",
+				},
+			},
+		},
+	}
+}
+
 // reconcileService creates or updates the Service for the JsonServer
-func (r *JsonServerReconciler) reconcileService(ctx context.Context, jsonServer *examplecomv1.JsonServer) (*corev1.Service, error) {
+func (r *JsonServerReconciler) reconcileService(ctx context.Context, jsonServer *examplecomv1.JsonServer, viaActivator bool) (*corev1.Service, error) {
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      jsonServer.Name,
@@ -242,6 +827,23 @@ func (r *JsonServerReconciler) reconcileService(ctx context.Context, jsonServer
 		},
 	}
 
+	// The cluster IP cannot be changed in place, so switching to or from a
+	// headless Service requires recreating it
+	existing := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(service), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && (existing.Spec.ClusterIP == corev1.ClusterIPNone) != isHeadless(jsonServer) {
+		err := r.Delete(ctx, existing)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			r.recordDeletion(jsonServer, existing)
+		}
+	}
+
 	// Create or Update the Service
 	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
 		// Set the owner reference
@@ -256,7 +858,26 @@ func (r *JsonServerReconciler) reconcileService(ctx context.Context, jsonServer
 			"app.kubernetes.io/managed-by": "json-server-controller",
 		}
 
+		// Add user annotations, keeping the ones set by other controllers
+		if jsonServer.Spec.Service != nil && len(jsonServer.Spec.Service.Annotations) > 0 {
+			if service.Annotations == nil {
+				service.Annotations = map[string]string{}
+			}
+			for k, v := range jsonServer.Spec.Service.Annotations {
+				service.Annotations[k] = v
+			}
+		}
+
+		// Keep the values allocated by the cluster
+		clusterIP := service.Spec.ClusterIP
+		clusterIPs := service.Spec.ClusterIPs
+		var allocatedNodePort int32
+		if len(service.Spec.Ports) > 0 {
+			allocatedNodePort = service.Spec.Ports[0].NodePort
+		}
+
 		// Set the spec
+		port := servicePort(jsonServer)
 		service.Spec = corev1.ServiceSpec{
 			Selector: map[string]string{
 				"app": jsonServer.Name,
@@ -264,12 +885,38 @@ func (r *JsonServerReconciler) reconcileService(ctx context.Context, jsonServer
 			Ports: []corev1.ServicePort{
 				{
 					Name:       "http",
-					Port:       3000,
-					TargetPort: intstr.FromInt(3000),
+					Port:       port,
+					TargetPort: intstr.FromString("http"),
 					Protocol:   corev1.ProtocolTCP,
 				},
 			},
-			Type: corev1.ServiceTypeClusterIP,
+			Type:       corev1.ServiceTypeClusterIP,
+			ClusterIP:  clusterIP,
+			ClusterIPs: clusterIPs,
+		}
+
+		// While routed through the activator the endpoints point at it, see reconcileActivatorRoute
+		if viaActivator {
+			service.Spec.Selector = nil
+		}
+
+		if jsonServer.Spec.Service == nil {
+			return nil
+		}
+
+		spec := jsonServer.Spec.Service
+		service.Spec.SessionAffinity = spec.SessionAffinity
+		switch spec.Type {
+		case examplecomv1.ServiceTypeHeadless:
+			service.Spec.ClusterIP = corev1.ClusterIPNone
+			service.Spec.ClusterIPs = nil
+		case examplecomv1.ServiceTypeNodePort, examplecomv1.ServiceTypeLoadBalancer:
+			service.Spec.Type = corev1.ServiceType(spec.Type)
+			service.Spec.ExternalTrafficPolicy = spec.ExternalTrafficPolicy
+			service.Spec.Ports[0].NodePort = allocatedNodePort
+			if spec.NodePort != 0 {
+				service.Spec.Ports[0].NodePort = spec.NodePort
+			}
 		}
 
 		return nil
@@ -280,55 +927,199 @@ func (r *JsonServerReconciler) reconcileService(ctx context.Context, jsonServer
 	}
 
 	log.FromContext(ctx).Info("Service operation completed", "operation", op)
+	r.recordOperation(jsonServer, "Service", service.Name, op)
 	return service, nil
 }
 
-// updateStatusWithError updates the JsonServer status with an error
-func (r *JsonServerReconciler) updateStatusWithError(ctx context.Context, jsonServer *examplecomv1.JsonServer, message string) (ctrl.Result, error) {
-	// Get the latest version of the JsonServer
-	latest := &examplecomv1.JsonServer{}
-	if err := r.Get(ctx, types.NamespacedName{Name: jsonServer.Name, Namespace: jsonServer.Namespace}, latest); err != nil {
+// servicePort returns the port json-server listens on and the Service exposes
+func servicePort(jsonServer *examplecomv1.JsonServer) int32 {
+	if jsonServer.Spec.Service != nil && jsonServer.Spec.Service.Port != 0 {
+		return jsonServer.Spec.Service.Port
+	}
+	return defaultPort
+}
+
+// isHeadless reports whether the JsonServer asks for a headless Service
+func isHeadless(jsonServer *examplecomv1.JsonServer) bool {
+	return jsonServer.Spec.Service != nil && jsonServer.Spec.Service.Type == examplecomv1.ServiceTypeHeadless
+}
+
+// updateStatusWithError updates the JsonServer status with an error.
+// The failing condition and Ready are both set to False with the given reason.
+func (r *JsonServerReconciler) updateStatusWithError(ctx context.Context, jsonServer *examplecomv1.JsonServer, conditionType, reason, message string) (ctrl.Result, error) {
+	return r.setErrorStatus(ctx, jsonServer, conditionType, reason, reason, message)
+}
+
+// setErrorStatus sets the Error state with the condition reason on the failing
+// condition and Ready, and the failure reason in status.reason
+func (r *JsonServerReconciler) setErrorStatus(ctx context.Context, jsonServer *examplecomv1.JsonServer, conditionType, conditionReason, failureReason, message string) (ctrl.Result, error) {
+	// Report whatever pods are still running from an earlier reconcile
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: jsonServer.Name, Namespace: jsonServer.Namespace}, deployment); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		deployment = nil
+	}
+
+	setCondition(jsonServer, conditionType, metav1.ConditionFalse, conditionReason, message)
+	setCondition(jsonServer, examplecomv1.ConditionReady, metav1.ConditionFalse, conditionReason, message)
+	r.event(jsonServer, corev1.EventTypeWarning, conditionReason, message)
+
+	if err := r.writeStatus(ctx, jsonServer, deployment, "Error", message, failureReason); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	latest.Status.State = "Error"
-	latest.Status.Message = message
-	latest.Status.Replicas = jsonServer.Spec.Replicas
+	// Failed JsonServers still reset, go idle and expire on time
+	return ctrl.Result{RequeueAfter: nextRequeue(r.untilReset(jsonServer), r.untilIdle(jsonServer), r.untilExpiryRefresh(jsonServer))}, nil
+}
 
-	if err := r.Status().Update(ctx, latest); err != nil {
-		log.FromContext(ctx).Error(err, "Failed to update JsonServer status")
+// updateStatusSuccess updates the JsonServer status to Synced once the Deployment
+// has rolled out, or to Progressing while the rollout is still running
+func (r *JsonServerReconciler) updateStatusSuccess(ctx context.Context, jsonServer *examplecomv1.JsonServer, deployment *appsv1.Deployment) (ctrl.Result, error) {
+	var state, message string
+	switch {
+	case jsonServer.Spec.Suspend:
+		state = "Suspended"
+		message = "Suspended, scaled to zero"
+		if deployment.Status.Replicas > 0 {
+			message = fmt.Sprintf("Suspending, %d pods terminating", deployment.Status.Replicas)
+		}
+		setCondition(jsonServer, examplecomv1.ConditionDeploymentAvailable, metav1.ConditionFalse, examplecomv1.ReasonSuspended, "spec.suspend is set")
+		setCondition(jsonServer, examplecomv1.ConditionReady, metav1.ConditionFalse, examplecomv1.ReasonSuspended, "spec.suspend is set")
+		r.rollouts.Delete(client.ObjectKeyFromObject(jsonServer))
+	case jsonServer.Status.IdleSince != nil:
+		state = "Idle"
+		message = fmt.Sprintf("Idle since %s, scaled to zero until the next request", jsonServer.Status.IdleSince.UTC().Format(time.RFC3339))
+		setCondition(jsonServer, examplecomv1.ConditionDeploymentAvailable, metav1.ConditionFalse, examplecomv1.ReasonIdle, message)
+		setCondition(jsonServer, examplecomv1.ConditionReady, metav1.ConditionFalse, examplecomv1.ReasonIdle, message)
+		r.rollouts.Delete(client.ObjectKeyFromObject(jsonServer))
+	case deploymentRolledOut(deployment):
+		// Report the rollout once, when Ready turns to RolloutComplete
+		if ready := meta.FindStatusCondition(jsonServer.Status.Conditions, examplecomv1.ConditionReady); ready == nil || ready.Reason != examplecomv1.ReasonRolloutComplete || ready.ObservedGeneration != jsonServer.Generation {
+			r.event(jsonServer, corev1.EventTypeNormal, examplecomv1.ReasonRolloutComplete, "Deployment %s rolled out %d replicas", deployment.Name, deployment.Status.AvailableReplicas)
+		}
+		r.observeRollout(jsonServer)
+		state = "Synced"
+		message = "Synced succesfully!"
+		setCondition(jsonServer, examplecomv1.ConditionDeploymentAvailable, metav1.ConditionTrue, examplecomv1.ReasonRolloutComplete, "All replicas are updated and available")
+		setCondition(jsonServer, examplecomv1.ConditionReady, metav1.ConditionTrue, examplecomv1.ReasonRolloutComplete, "JsonServer is serving the current spec")
+	default:
+		state = "Progressing"
+		message = fmt.Sprintf("Waiting for rollout: %d of %d updated replicas available",
+			deployment.Status.AvailableReplicas, *deployment.Spec.Replicas)
+		setCondition(jsonServer, examplecomv1.ConditionDeploymentAvailable, metav1.ConditionFalse, examplecomv1.ReasonRolloutInProgress, message)
+		setCondition(jsonServer, examplecomv1.ConditionReady, metav1.ConditionFalse, examplecomv1.ReasonRolloutInProgress, message)
+	}
+	if err := r.writeStatus(ctx, jsonServer, deployment, state, message, ""); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// Deployment status changes trigger a new reconcile through Owns, no requeue needed
 	return ctrl.Result{}, nil
 }
 
-// updateStatusSuccess updates the JsonServer status to Synced
-func (r *JsonServerReconciler) updateStatusSuccess(ctx context.Context, jsonServer *examplecomv1.JsonServer) (ctrl.Result, error) {
+// writeStatus writes the status computed during the reconcile onto the latest
+// version of the JsonServer, with the given state, message and failure reason
+// and the pod counts of the Deployment
+func (r *JsonServerReconciler) writeStatus(ctx context.Context, jsonServer *examplecomv1.JsonServer, deployment *appsv1.Deployment, state, message, reason string) error {
 	// Get the latest version of the JsonServer
 	latest := &examplecomv1.JsonServer{}
 	if err := r.Get(ctx, types.NamespacedName{Name: jsonServer.Name, Namespace: jsonServer.Namespace}, latest); err != nil {
-		return ctrl.Result{}, err
+		return err
 	}
 
-	latest.Status.State = "Synced"
-	latest.Status.Message = "Synced succesfully!"
-	latest.Status.Replicas = jsonServer.Spec.Replicas
+	latest.Status = *jsonServer.Status.DeepCopy()
+	latest.Status.State = state
+	latest.Status.Message = message
+	latest.Status.Reason = reason
+	latest.Status.ObservedGeneration = jsonServer.Generation
+	setReplicaStatus(&latest.Status, deployment)
 
 	if err := r.Status().Update(ctx, latest); err != nil {
 		log.FromContext(ctx).Error(err, "Failed to update JsonServer status")
-		return ctrl.Result{}, err
+		return err
 	}
+	return nil
+}
 
-	return ctrl.Result{}, nil
+// setCondition sets a condition on the in-memory JsonServer, keeping the
+// transition time when the status did not change
+func setCondition(jsonServer *examplecomv1.JsonServer, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&jsonServer.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: jsonServer.Generation,
+	})
+}
+
+// setReplicaStatus copies the pod counts of the Deployment into the JsonServer status
+func setReplicaStatus(status *examplecomv1.JsonServerStatus, deployment *appsv1.Deployment) {
+	if deployment == nil {
+		status.Replicas = 0
+		status.ReadyReplicas = 0
+		status.AvailableReplicas = 0
+		status.UpdatedReplicas = 0
+		return
+	}
+
+	status.Replicas = deployment.Status.Replicas
+	status.ReadyReplicas = deployment.Status.ReadyReplicas
+	status.AvailableReplicas = deployment.Status.AvailableReplicas
+	status.UpdatedReplicas = deployment.Status.UpdatedReplicas
+}
+
+// deploymentRolledOut reports whether the Deployment controller has observed the
+// latest spec and every desired pod is updated and available, with no old pods left
+func deploymentRolledOut(deployment *appsv1.Deployment) bool {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == desired &&
+		deployment.Status.AvailableReplicas == desired &&
+		deployment.Status.Replicas == desired
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *JsonServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	// Index spec.source and spec.restoreFrom references so that changes to them can be mapped back
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &examplecomv1.JsonServer{}, configMapSourceIndex, indexConfigMapSource); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &examplecomv1.JsonServer{}, secretSourceIndex, indexSecretSource); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &examplecomv1.JsonServer{}, restoreFromIndex, indexRestoreFrom); err != nil {
+		return err
+	}
+
+	// Count JsonServers per state on every scrape of the metrics endpoint
+	if err := metrics.Registry.Register(&stateCollector{reader: mgr.GetClient()}); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&examplecomv1.JsonServer{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.ConfigMap{}).
-		Complete(r)
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&discoveryv1.EndpointSlice{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.jsonServersForConfigMap)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.jsonServersForSecret), builder.OnlyMetadata).
+		Watches(&examplecomv1.JsonServerSnapshot{}, handler.EnqueueRequestsFromMapFunc(r.jsonServersForSnapshot))
+
+	// HTTPRoutes can only be watched when the Gateway API CRDs exist
+	if r.GatewayAPI {
+		b = b.Owns(&gatewayv1.HTTPRoute{})
+	}
+
+	return b.Complete(r)
 }
@@ -2,14 +2,36 @@ package controller
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	examplev1 "github.com/yourusername/json-server-controller/api/v1"
@@ -20,6 +42,7 @@ func TestReconcile_CreatesDeployment(t *testing.T) {
 	_ = examplev1.AddToScheme(scheme)
 	_ = appsv1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
 
 	jsonServer := &examplev1.JsonServer{
 		ObjectMeta: metav1.ObjectMeta{
@@ -75,6 +98,7 @@ func TestReconcile_CreatesConfigMap(t *testing.T) {
 	_ = examplev1.AddToScheme(scheme)
 	_ = appsv1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
 
 	jsonServer := &examplev1.JsonServer{
 		ObjectMeta: metav1.ObjectMeta{
@@ -110,10 +134,16 @@ func TestReconcile_CreatesConfigMap(t *testing.T) {
 		t.Fatalf("reconcile failed: %v", err)
 	}
 
-	// Check configmap was created
+	// Check configmap was created as the first revision
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if len(updated.Status.Revisions) != 1 {
+		t.Fatalf("expected one revision in status, got %+v", updated.Status.Revisions)
+	}
+
 	configMap := &corev1.ConfigMap{}
 	err = client.Get(context.Background(), types.NamespacedName{
-		Name:      "app-test-config",
+		Name:      "app-test-config-" + updated.Status.ConfigHash,
 		Namespace: "default",
 	}, configMap)
 	if err != nil {
@@ -123,4 +153,2159 @@ func TestReconcile_CreatesConfigMap(t *testing.T) {
 	if configMap.Data["db.json"] != `{"posts": [{"id": 1}]}` {
 		t.Errorf("configmap data mismatch: %s", configMap.Data["db.json"])
 	}
+	if configMap.Immutable == nil || !*configMap.Immutable {
+		t.Error("expected configmap to be immutable")
+	}
+}
+
+func TestReconcile_PersistentStorage(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:         1,
+			JsonConfig:       `{"users": []}`,
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-creds"}},
+			Storage: &examplev1.StorageSpec{
+				Mode: examplev1.StorageModePersistent,
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client:    client,
+		Scheme:    scheme,
+		SeedImage: "registry.internal/library/busybox:1.36",
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	// Check the claim was created
+	pvc := &corev1.PersistentVolumeClaim{}
+	err = client.Get(context.Background(), types.NamespacedName{
+		Name:      "app-test-data",
+		Namespace: "default",
+	}, pvc)
+	if err != nil {
+		t.Fatalf("expected persistentvolumeclaim to be created: %v", err)
+	}
+
+	// Check the deployment seeds and mounts the claim
+	deployment := &appsv1.Deployment{}
+	err = client.Get(context.Background(), types.NamespacedName{
+		Name:      "app-test",
+		Namespace: "default",
+	}, deployment)
+	if err != nil {
+		t.Fatalf("expected deployment to be created: %v", err)
+	}
+
+	podSpec := deployment.Spec.Template.Spec
+	if len(podSpec.InitContainers) != 1 {
+		t.Fatalf("expected 1 init container, got %d", len(podSpec.InitContainers))
+	}
+	if podSpec.InitContainers[0].Image != "registry.internal/library/busybox:1.36" {
+		t.Errorf("expected the seed image of the controller, got %s", podSpec.InitContainers[0].Image)
+	}
+	if len(podSpec.ImagePullSecrets) != 1 || podSpec.ImagePullSecrets[0].Name != "registry-creds" {
+		t.Errorf("expected the pull secrets on the pod, covering the seed image, got %v", podSpec.ImagePullSecrets)
+	}
+	if podSpec.Containers[0].VolumeMounts[0].Name != "data" {
+		t.Errorf("expected /data to be backed by the claim, got %s", podSpec.Containers[0].VolumeMounts[0].Name)
+	}
+	if deployment.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		t.Errorf("expected Recreate strategy, got %s", deployment.Spec.Strategy.Type)
+	}
+}
+
+func TestReconcile_StatusFollowsRollout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   2,
+			JsonConfig: `{"users": []}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer, &appsv1.Deployment{}).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	// No pods are running yet
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.State != "Progressing" {
+		t.Errorf("expected Progressing state before rollout, got %s", updated.Status.State)
+	}
+
+	// Simulate the Deployment controller finishing the rollout
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	deployment.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: deployment.Generation,
+		Replicas:           2,
+		ReadyReplicas:      2,
+		AvailableReplicas:  2,
+		UpdatedReplicas:    2,
+	}
+	if err := client.Status().Update(context.Background(), deployment); err != nil {
+		t.Fatalf("failed to update deployment status: %v", err)
+	}
+
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.State != "Synced" {
+		t.Errorf("expected Synced state after rollout, got %s", updated.Status.State)
+	}
+	if updated.Status.ReadyReplicas != 2 {
+		t.Errorf("expected 2 ready replicas, got %d", updated.Status.ReadyReplicas)
+	}
+}
+
+func TestReconcile_InvalidJsonSetsConditions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "app-test",
+			Namespace:  "default",
+			Generation: 3,
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{invalid json}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+
+	if updated.Status.ObservedGeneration != updated.Generation {
+		t.Errorf("expected observedGeneration %d, got %d", updated.Generation, updated.Status.ObservedGeneration)
+	}
+	if !meta.IsStatusConditionFalse(updated.Status.Conditions, examplev1.ConditionConfigValid) {
+		t.Error("expected ConfigValid condition to be False")
+	}
+	ready := meta.FindStatusCondition(updated.Status.Conditions, examplev1.ConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Reason != examplev1.ReasonInvalidJSON {
+		t.Errorf("expected Ready=False with reason %s, got %+v", examplev1.ReasonInvalidJSON, ready)
+	}
+}
+
+func TestReconcile_Image(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:         1,
+			JsonConfig:       `{"users": []}`,
+			Image:            "registry.internal/backplane/json-server:1.0",
+			ImagePullPolicy:  corev1.PullAlways,
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-creds"}},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client:       client,
+		Scheme:       scheme,
+		DefaultImage: "mirror.internal/json-server",
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if container.Image != "registry.internal/backplane/json-server:1.0" {
+		t.Errorf("expected spec.image to override the default, got %s", container.Image)
+	}
+	if container.ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("expected pull policy Always, got %s", container.ImagePullPolicy)
+	}
+	if len(deployment.Spec.Template.Spec.ImagePullSecrets) != 1 {
+		t.Errorf("expected 1 image pull secret, got %d", len(deployment.Spec.Template.Spec.ImagePullSecrets))
+	}
+
+	// A mirrored image runs as the default uid, its user is named rather than numeric
+	podSecurityContext := deployment.Spec.Template.Spec.SecurityContext
+	if podSecurityContext.RunAsUser == nil || *podSecurityContext.RunAsUser != defaultRunAsUser || podSecurityContext.RunAsNonRoot == nil || !*podSecurityContext.RunAsNonRoot {
+		t.Errorf("expected runAsNonRoot with uid %d for a mirrored image, got %+v", defaultRunAsUser, podSecurityContext)
+	}
+}
+
+func TestReconcile_PodTemplateOverrides(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+			PodTemplate: &examplev1.PodTemplateOverrides{
+				Labels:            map[string]string{"team": "qa", "app": "other"},
+				NodeSelector:      map[string]string{"pool": "mocks"},
+				PriorityClassName: "low",
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+
+	template := deployment.Spec.Template
+	if template.Labels["team"] != "qa" {
+		t.Errorf("expected pod label team=qa, got %v", template.Labels)
+	}
+	if template.Labels["app"] != "app-test" {
+		t.Errorf("expected selector label to be kept, got app=%s", template.Labels["app"])
+	}
+	if template.Spec.NodeSelector["pool"] != "mocks" || template.Spec.PriorityClassName != "low" {
+		t.Errorf("expected scheduling overrides to be applied, got %v / %s", template.Spec.NodeSelector, template.Spec.PriorityClassName)
+	}
+
+	container := template.Spec.Containers[0]
+	if container.Resources.Limits.Memory().String() != "512Mi" {
+		t.Errorf("expected memory limit 512Mi, got %s", container.Resources.Limits.Memory())
+	}
+	if container.SecurityContext == nil || container.SecurityContext.AllowPrivilegeEscalation == nil || *container.SecurityContext.AllowPrivilegeEscalation {
+		t.Error("expected default security context to disallow privilege escalation")
+	}
+	if runAsUser := template.Spec.SecurityContext.RunAsUser; runAsUser == nil || *runAsUser != defaultRunAsUser {
+		t.Errorf("expected the default image to run as uid %d, got %v", defaultRunAsUser, runAsUser)
+	}
+}
+
+func TestReconcile_ConfigChangeRollsPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	firstHash := deployment.Spec.Template.Annotations[configHashAnnotation]
+	if firstHash == "" {
+		t.Fatal("expected config hash annotation on the pod template")
+	}
+
+	// Change the data
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	jsonServer.Spec.JsonConfig = `{"users": [{"id": 1}]}`
+	if err := client.Update(context.Background(), jsonServer); err != nil {
+		t.Fatalf("failed to update jsonserver: %v", err)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	secondHash := deployment.Spec.Template.Annotations[configHashAnnotation]
+	if secondHash == firstHash {
+		t.Error("expected config hash annotation to change with jsonConfig")
+	}
+
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	if jsonServer.Status.ConfigHash != secondHash {
+		t.Errorf("expected status.configHash %s, got %s", secondHash, jsonServer.Status.ConfigHash)
+	}
+}
+
+func TestReconcile_InPlaceKeepsPodTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:       1,
+			JsonConfig:     `{"users": []}`,
+			ReloadStrategy: examplev1.ReloadStrategyInPlace,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	firstTemplate := deployment.Spec.Template.DeepCopy()
+	volume := firstTemplate.Spec.Volumes[0]
+	if volume.ConfigMap == nil || volume.ConfigMap.Name != "app-test-config" {
+		t.Fatalf("expected the current ConfigMap to be mounted, got %+v", volume)
+	}
+
+	// Change the data
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	jsonServer.Spec.JsonConfig = `{"users": [{"id": 1}]}`
+	if err := client.Update(context.Background(), jsonServer); err != nil {
+		t.Fatalf("failed to update jsonserver: %v", err)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if !equality.Semantic.DeepEqual(firstTemplate, &deployment.Spec.Template) {
+		t.Errorf("expected the pod template to stay unchanged, got %+v", deployment.Spec.Template)
+	}
+
+	current := &corev1.ConfigMap{}
+	if err := client.Get(context.Background(), types.NamespacedName{Name: "app-test-config", Namespace: "default"}, current); err != nil {
+		t.Fatalf("expected the current ConfigMap: %v", err)
+	}
+	if current.Data["db.json"] != `{"users": [{"id": 1}]}` {
+		t.Errorf("expected the current ConfigMap to hold the new data, got %s", current.Data["db.json"])
+	}
+
+	// Both revisions are still recorded next to the current ConfigMap
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	if len(jsonServer.Status.Revisions) != 2 {
+		t.Errorf("expected 2 revisions, got %+v", jsonServer.Status.Revisions)
+	}
+	if current.Annotations[configHashAnnotation] != jsonServer.Status.ConfigHash {
+		t.Errorf("expected the current ConfigMap at revision %s, got %s", jsonServer.Status.ConfigHash, current.Annotations[configHashAnnotation])
+	}
+}
+
+func TestReconcile_ServiceSpec(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+			Service: &examplev1.ServiceSpec{
+				Type:        examplev1.ServiceTypeLoadBalancer,
+				Port:        8080,
+				NodePort:    30080,
+				Annotations: map[string]string{"lb.example.com/internal": "true"},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	service := &corev1.Service{}
+	_ = client.Get(context.Background(), req.NamespacedName, service)
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		t.Errorf("expected LoadBalancer service, got %s", service.Spec.Type)
+	}
+	if service.Spec.Ports[0].Port != 8080 || service.Spec.Ports[0].NodePort != 30080 {
+		t.Errorf("expected port 8080 and nodePort 30080, got %+v", service.Spec.Ports[0])
+	}
+	if service.Annotations["lb.example.com/internal"] != "true" {
+		t.Errorf("expected service annotation, got %v", service.Annotations)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if deployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort != 8080 {
+		t.Errorf("expected container port 8080, got %d", deployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort)
+	}
+}
+
+func TestReconcile_ExposeIngress(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+			Expose: &examplev1.ExposeSpec{
+				Type:          examplev1.ExposeTypeIngress,
+				Host:          "{{name}}.{{namespace}}.mocks.example.internal",
+				PathPrefix:    "/",
+				TLSSecretName: "mocks-tls",
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	ingress := &networkingv1.Ingress{}
+	if err := client.Get(context.Background(), req.NamespacedName, ingress); err != nil {
+		t.Fatalf("expected ingress to be created: %v", err)
+	}
+	if ingress.Spec.Rules[0].Host != "app-test.default.mocks.example.internal" {
+		t.Errorf("expected rendered host, got %s", ingress.Spec.Rules[0].Host)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.ExternalURL != "https://app-test.default.mocks.example.internal/" {
+		t.Errorf("unexpected external URL %s", updated.Status.ExternalURL)
+	}
+
+	// Removing spec.expose deletes the Ingress
+	updated.Spec.Expose = nil
+	if err := client.Update(context.Background(), updated); err != nil {
+		t.Fatalf("failed to update jsonserver: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if err := client.Get(context.Background(), req.NamespacedName, ingress); !errors.IsNotFound(err) {
+		t.Errorf("expected ingress to be deleted, got %v", err)
+	}
+}
+
+func TestReconcile_SecretSource(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fixtures",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"db.json": []byte(`{"accounts": [{"id": 1}]}`),
+		},
+	}
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas: 1,
+			Source: &examplev1.ConfigSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "fixtures"},
+					Key:                  "db.json",
+				},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer, secret).
+		WithStatusSubresource(jsonServer).
+		WithIndex(&examplev1.JsonServer{}, secretSourceIndex, indexSecretSource).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	// The secret content is mounted, not copied
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	configMapName := "app-test-config-" + updated.Status.ConfigHash
+
+	configMap := &corev1.ConfigMap{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: configMapName, Namespace: "default"}, configMap)
+	if _, ok := configMap.Data["db.json"]; ok {
+		t.Error("expected secret data not to be copied into the configmap")
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	volume := deployment.Spec.Template.Spec.Volumes[0]
+	if volume.Projected == nil || volume.Projected.Sources[1].Secret == nil {
+		t.Fatalf("expected the secret to be projected into the config volume, got %+v", volume.VolumeSource)
+	}
+
+	if len(updated.Status.Resources) != 1 || updated.Status.Resources[0].Name != "accounts" {
+		t.Errorf("expected resources from the secret, got %+v", updated.Status.Resources)
+	}
+
+	// Changes to the secret are mapped back to the JsonServer
+	requests := r.jsonServersForSecret(context.Background(), secret)
+	if len(requests) != 1 || requests[0].NamespacedName != req.NamespacedName {
+		t.Errorf("expected secret to map to app-test, got %+v", requests)
+	}
+}
+
+func TestReconcile_LargeConfigIsShardedAndCompressed(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	// Random data barely compresses, so it needs more than one ConfigMap
+	blob := make([]byte, 1200*1024)
+	_, _ = rand.New(rand.NewSource(1)).Read(blob)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: fmt.Sprintf(`{"blobs": [%q]}`, base64.StdEncoding.EncodeToString(blob)),
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	configMapName := "app-test-config-" + updated.Status.ConfigHash
+
+	configMap := &corev1.ConfigMap{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: configMapName, Namespace: "default"}, configMap)
+	if _, ok := configMap.Data["db.json"]; ok {
+		t.Error("expected large db.json not to be stored uncompressed")
+	}
+	if len(configMap.BinaryData[chunkKey(0)]) == 0 {
+		t.Errorf("expected first compressed chunk in binaryData, got keys %v", configMap.BinaryData)
+	}
+
+	shard := &corev1.ConfigMap{}
+	err = client.Get(context.Background(), types.NamespacedName{Name: configMapName + "-1", Namespace: "default"}, shard)
+	if err != nil {
+		t.Fatalf("expected shard ConfigMap: %v", err)
+	}
+	if len(shard.BinaryData[chunkKey(1)]) == 0 {
+		t.Errorf("expected second compressed chunk in shard, got keys %v", shard.BinaryData)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: "app-test", Namespace: "default"}, deployment)
+	podSpec := deployment.Spec.Template.Spec
+	if len(podSpec.InitContainers) != 1 {
+		t.Fatalf("expected an init container to unpack the data, got %d", len(podSpec.InitContainers))
+	}
+	if projected := podSpec.Volumes[0].Projected; projected == nil || len(projected.Sources) != 2 {
+		t.Errorf("expected both ConfigMaps projected into the config volume, got %+v", podSpec.Volumes[0])
+	}
+
+	// Pruning the large revision removes its shard
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	jsonServer.Spec.JsonConfig = `{"users": []}`
+	jsonServer.Spec.RevisionHistoryLimit = ptr.To[int32](0)
+	_ = client.Update(context.Background(), jsonServer)
+
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	err = client.Get(context.Background(), types.NamespacedName{Name: configMapName + "-1", Namespace: "default"}, shard)
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected shard ConfigMap to be deleted, got %v", err)
+	}
+}
+
+func TestReconcile_KeepsRevisionDuringRollout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:             1,
+			JsonConfig:           `{"posts": []}`,
+			RevisionHistoryLimit: ptr.To[int32](0),
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer, &appsv1.Deployment{}, &appsv1.ReplicaSet{}).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	oldConfigMap := "app-test-config-" + jsonServer.Status.ConfigHash
+
+	// The pods of the old ReplicaSet mount the first revision
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	oldReplicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test-old",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "app-test"},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Selector: deployment.Spec.Selector,
+			Template: deployment.Spec.Template,
+		},
+	}
+	_ = controllerutil.SetControllerReference(deployment, oldReplicaSet, scheme)
+	if err := client.Create(context.Background(), oldReplicaSet); err != nil {
+		t.Fatalf("failed to create ReplicaSet: %v", err)
+	}
+	oldReplicaSet.Status.Replicas = 1
+	_ = client.Status().Update(context.Background(), oldReplicaSet)
+
+	// New data rolls out while the old pod still runs
+	jsonServer.Spec.JsonConfig = `{"users": []}`
+	_ = client.Update(context.Background(), jsonServer)
+	deployment.Status.Replicas = 2
+	deployment.Status.UpdatedReplicas = 1
+	_ = client.Status().Update(context.Background(), deployment)
+
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := client.Get(context.Background(), types.NamespacedName{Name: oldConfigMap, Namespace: "default"}, configMap); err != nil {
+		t.Errorf("expected the revision of the old pods to be kept during the rollout: %v", err)
+	}
+
+	// Once every pod is updated the revision is pruned
+	deployment.Status.Replicas = 1
+	_ = client.Status().Update(context.Background(), deployment)
+	oldReplicaSet.Status.Replicas = 0
+	_ = client.Status().Update(context.Background(), oldReplicaSet)
+
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	err = client.Get(context.Background(), types.NamespacedName{Name: oldConfigMap, Namespace: "default"}, configMap)
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected the old revision to be pruned after the rollout, got %v", err)
+	}
+}
+
+func TestReconcile_RollbackTo(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"posts": [{"id": 1}]}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	good := jsonServer.Status.ConfigHash
+
+	// A bad fixture lands as a new revision
+	jsonServer.Spec.JsonConfig = `{"comments": []}`
+	_ = client.Update(context.Background(), jsonServer)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	if len(jsonServer.Status.Revisions) != 2 || jsonServer.Status.Revisions[1].Hash != good {
+		t.Fatalf("expected the previous revision to be kept, got %+v", jsonServer.Status.Revisions)
+	}
+
+	// Pin the previous revision
+	jsonServer.Spec.RollbackTo = good
+	_ = client.Update(context.Background(), jsonServer)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	if jsonServer.Status.ConfigHash != good {
+		t.Errorf("expected served hash %s, got %s", good, jsonServer.Status.ConfigHash)
+	}
+	if len(jsonServer.Status.Resources) != 1 || jsonServer.Status.Resources[0].Name != "posts" {
+		t.Errorf("expected resources of the pinned revision, got %+v", jsonServer.Status.Resources)
+	}
+	cond := meta.FindStatusCondition(jsonServer.Status.Conditions, examplev1.ConditionConfigMapReady)
+	if cond == nil || cond.Reason != examplev1.ReasonRolledBack {
+		t.Errorf("expected ConfigMapReady reason RolledBack, got %+v", cond)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	volume := deployment.Spec.Template.Spec.Volumes[0]
+	if volume.ConfigMap == nil || volume.ConfigMap.Name != "app-test-config-"+good {
+		t.Errorf("expected the pinned revision to be mounted, got %+v", volume.VolumeSource)
+	}
+
+	// Unknown revisions are reported
+	jsonServer.Spec.RollbackTo = "0123456789abcdef"
+	_ = client.Update(context.Background(), jsonServer)
+	_, _ = r.Reconcile(context.Background(), req)
+	_ = client.Get(context.Background(), req.NamespacedName, jsonServer)
+	cond = meta.FindStatusCondition(jsonServer.Status.Conditions, examplev1.ConditionConfigMapReady)
+	if cond == nil || cond.Reason != examplev1.ReasonRevisionNotFound {
+		t.Errorf("expected ConfigMapReady reason RevisionNotFound, got %+v", cond)
+	}
+}
+
+func TestReconcile_RestoreFromSnapshot(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	snapshot := &examplev1.JsonServerSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-old-snapshot",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSnapshotSpec{
+			JsonServerName: "app-old",
+		},
+		Status: examplev1.JsonServerSnapshotStatus{
+			Phase:    examplev1.SnapshotPhaseCompleted,
+			DataName: "app-old-snapshot",
+		},
+	}
+	data := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-old-snapshot",
+			Namespace: "default",
+		},
+		Data: map[string]string{
+			"db.json": `{"orders": [{"id": 7}]}`,
+		},
+	}
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas: 1,
+			RestoreFrom: &examplev1.RestoreSource{
+				SnapshotName: "app-old-snapshot",
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer, snapshot, data).
+		WithStatusSubresource(jsonServer, snapshot).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	configMap := &corev1.ConfigMap{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: "app-test-config-" + updated.Status.ConfigHash, Namespace: "default"}, configMap)
+	if configMap.Data["db.json"] != `{"orders": [{"id": 7}]}` {
+		t.Errorf("expected the snapshot data to be served, got %q", configMap.Data["db.json"])
+	}
+
+	// Pending snapshots block the JsonServer
+	snapshot.Status.Phase = examplev1.SnapshotPhasePending
+	_ = client.Status().Update(context.Background(), snapshot)
+	_, _ = r.Reconcile(context.Background(), req)
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	cond := meta.FindStatusCondition(updated.Status.Conditions, examplev1.ConditionConfigValid)
+	if cond == nil || cond.Reason != examplev1.ReasonSnapshotNotReady {
+		t.Errorf("expected ConfigValid reason SnapshotNotReady, got %+v", cond)
+	}
+}
+
+func TestReconcile_ResetOnRequest(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+			Annotations: map[string]string{
+				examplev1.ResetRequestedAtAnnotation: "2024-05-01T10:00:00Z",
+			},
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"posts": []}`,
+			Storage: &examplev1.StorageSpec{
+				Mode: examplev1.StorageModePersistent,
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	now := time.Date(2024, 5, 1, 10, 0, 5, 0, time.UTC)
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+		Clock:  clocktesting.NewFakePassiveClock(now),
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.LastResetTime == nil || !updated.Status.LastResetTime.Time.Equal(now) {
+		t.Fatalf("expected last reset time %v, got %v", now, updated.Status.LastResetTime)
+	}
+	if updated.Status.ObservedResetRequest != "2024-05-01T10:00:00Z" {
+		t.Errorf("expected the reset request to be observed, got %q", updated.Status.ObservedResetRequest)
+	}
+
+	// The pods restart and the init container reseeds the volume
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if deployment.Spec.Template.Annotations[resetAtAnnotation] != "2024-05-01T10:00:05Z" {
+		t.Errorf("expected reset annotation on the pod template, got %v", deployment.Spec.Template.Annotations)
+	}
+	initContainer := deployment.Spec.Template.Spec.InitContainers[0]
+	if initContainer.Env[0].Value != "2024-05-01T10:00:05Z" {
+		t.Errorf("expected reset token in the init container, got %+v", initContainer.Env)
+	}
+
+	// The same request is handled only once
+	r.Clock = clocktesting.NewFakePassiveClock(now.Add(time.Hour))
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if !updated.Status.LastResetTime.Time.Equal(now) {
+		t.Errorf("expected no second reset, got %v", updated.Status.LastResetTime)
+	}
+}
+
+func TestReconcile_ResetSchedule(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	created := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "app-test",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:      1,
+			JsonConfig:    `{"posts": []}`,
+			ResetSchedule: "0 * * * *",
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+		Clock:  clocktesting.NewFakePassiveClock(created.Add(10 * time.Minute)),
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	// Not due yet, requeue at the next full hour
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter != 20*time.Minute {
+		t.Errorf("expected requeue after 20m, got %v", result.RequeueAfter)
+	}
+
+	// Due, the data is reset
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(31 * time.Minute))
+	result, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.LastResetTime == nil {
+		t.Fatal("expected a scheduled reset")
+	}
+	if result.RequeueAfter != 59*time.Minute {
+		t.Errorf("expected requeue after 59m, got %v", result.RequeueAfter)
+	}
+
+	// A failing JsonServer is still reset on schedule
+	updated.Spec.Runtime = examplev1.RuntimeGo
+	_ = client.Update(context.Background(), updated)
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(50 * time.Minute))
+	result, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.State != "Error" {
+		t.Fatalf("expected Error state without a go runtime image, got %s", updated.Status.State)
+	}
+	if result.RequeueAfter != 40*time.Minute {
+		t.Errorf("expected requeue after 40m, got %v", result.RequeueAfter)
+	}
+}
+
+func TestReconcile_Suspend(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   2,
+			Suspend:    true,
+			JsonConfig: `{"posts": []}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if *deployment.Spec.Replicas != 0 {
+		t.Errorf("expected suspended Deployment with 0 replicas, got %d", *deployment.Spec.Replicas)
+	}
+
+	// Data and Service are kept
+	service := &corev1.Service{}
+	if err := client.Get(context.Background(), req.NamespacedName, service); err != nil {
+		t.Errorf("expected service to be kept: %v", err)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.State != "Suspended" {
+		t.Errorf("expected state Suspended, got %s", updated.Status.State)
+	}
+	cond := meta.FindStatusCondition(updated.Status.Conditions, examplev1.ConditionReady)
+	if cond == nil || cond.Reason != examplev1.ReasonSuspended {
+		t.Errorf("expected Ready reason Suspended, got %+v", cond)
+	}
+	if len(updated.Status.Revisions) != 1 {
+		t.Errorf("expected the data revision to be kept, got %+v", updated.Status.Revisions)
+	}
+
+	// Resuming scales back up
+	updated.Spec.Suspend = false
+	_ = client.Update(context.Background(), updated)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if *deployment.Spec.Replicas != 2 {
+		t.Errorf("expected resumed Deployment with 2 replicas, got %d", *deployment.Spec.Replicas)
+	}
+}
+
+func TestReconcile_Idle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+	_ = discoveryv1.AddToScheme(scheme)
+
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "app-test",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   2,
+			Idle:       &examplev1.IdleSpec{AfterMinutes: 30},
+			JsonConfig: `{"posts": []}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer, &appsv1.Deployment{}).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client:           client,
+		Scheme:           scheme,
+		Clock:            clocktesting.NewFakePassiveClock(created.Add(10 * time.Minute)),
+		ActivatorAddress: "10.0.0.7",
+		ActivatorPort:    8090,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	// Awake, requeue when the idle timeout expires
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter != 20*time.Minute {
+		t.Errorf("expected requeue after 20m, got %v", result.RequeueAfter)
+	}
+
+	// The Service points at the activator, the pods Service at the pods
+	service := &corev1.Service{}
+	_ = client.Get(context.Background(), req.NamespacedName, service)
+	if service.Spec.Selector != nil {
+		t.Errorf("expected a Service without selector, got %v", service.Spec.Selector)
+	}
+	slice := &discoveryv1.EndpointSlice{}
+	if err := client.Get(context.Background(), types.NamespacedName{Name: "app-test-activator", Namespace: "default"}, slice); err != nil {
+		t.Fatalf("expected activator EndpointSlice: %v", err)
+	}
+	if slice.Labels[discoveryv1.LabelServiceName] != "app-test" || slice.Endpoints[0].Addresses[0] != "10.0.0.7" || *slice.Ports[0].Port != 8090 {
+		t.Errorf("unexpected EndpointSlice: %+v", slice)
+	}
+	pods := &corev1.Service{}
+	if err := client.Get(context.Background(), types.NamespacedName{Name: "app-test-pods", Namespace: "default"}, pods); err != nil {
+		t.Fatalf("expected pods Service: %v", err)
+	}
+	if pods.Spec.Selector["app"] != "app-test" {
+		t.Errorf("expected pods Service to select the pods, got %v", pods.Spec.Selector)
+	}
+
+	// No requests for 30 minutes, scaled to zero
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(45 * time.Minute))
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if *deployment.Spec.Replicas != 0 {
+		t.Errorf("expected idle Deployment with 0 replicas, got %d", *deployment.Spec.Replicas)
+	}
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.State != "Idle" || updated.Status.IdleSince == nil {
+		t.Errorf("expected state Idle, got %s", updated.Status.State)
+	}
+	cond := meta.FindStatusCondition(updated.Status.Conditions, examplev1.ConditionReady)
+	if cond == nil || cond.Reason != examplev1.ReasonIdle {
+		t.Errorf("expected Ready reason Idle, got %+v", cond)
+	}
+
+	// A request recorded by the activator wakes it up
+	updated.Annotations = map[string]string{
+		examplev1.LastRequestAtAnnotation: created.Add(44 * time.Minute).Format(time.RFC3339),
+	}
+	_ = client.Update(context.Background(), updated)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if *deployment.Spec.Replicas != 2 {
+		t.Errorf("expected woken Deployment with 2 replicas, got %d", *deployment.Spec.Replicas)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.IdleSince != nil {
+		t.Errorf("expected idleSince to be cleared, got %v", updated.Status.IdleSince)
+	}
+
+	// Once a pod is ready the Service selects the pods again
+	deployment.Status.ReadyReplicas = 2
+	if err := client.Status().Update(context.Background(), deployment); err != nil {
+		t.Fatalf("failed to update deployment status: %v", err)
+	}
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(46 * time.Minute))
+	result, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, service)
+	if service.Spec.Selector["app"] != "app-test" {
+		t.Errorf("expected Service to select the ready pods, got %v", service.Spec.Selector)
+	}
+
+	// The activator drains the requests sent before the Service changed
+	if err := client.Get(context.Background(), types.NamespacedName{Name: "app-test-activator", Namespace: "default"}, slice); err != nil {
+		t.Fatalf("expected draining activator EndpointSlice: %v", err)
+	}
+	if len(slice.Endpoints) != 1 || *slice.Endpoints[0].Conditions.Ready {
+		t.Errorf("expected a not ready activator endpoint, got %+v", slice.Endpoints)
+	}
+	if result.RequeueAfter != activatorDrainPeriod {
+		t.Errorf("expected requeue after the drain period, got %v", result.RequeueAfter)
+	}
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(46*time.Minute + activatorDrainPeriod))
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if err := client.Get(context.Background(), types.NamespacedName{Name: "app-test-activator", Namespace: "default"}, slice); !errors.IsNotFound(err) {
+		t.Errorf("expected activator EndpointSlice to be deleted after draining, got %v", err)
+	}
+
+	// Without a recorded request the traffic goes through the activator again before scaling to zero
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(75 * time.Minute))
+	result, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter != 30*time.Minute {
+		t.Errorf("expected requeue after 30m, got %v", result.RequeueAfter)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if *deployment.Spec.Replicas != 2 {
+		t.Errorf("expected the Deployment to keep 2 replicas, got %d", *deployment.Spec.Replicas)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, service)
+	if service.Spec.Selector != nil {
+		t.Errorf("expected a Service without selector, got %v", service.Spec.Selector)
+	}
+	if err := client.Get(context.Background(), types.NamespacedName{Name: "app-test-activator", Namespace: "default"}, slice); err != nil {
+		t.Fatalf("expected activator EndpointSlice: %v", err)
+	}
+
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(106 * time.Minute))
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	if *deployment.Spec.Replicas != 0 {
+		t.Errorf("expected idle Deployment with 0 replicas, got %d", *deployment.Spec.Replicas)
+	}
+
+	// Without spec.idle the activator route is removed
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	updated.Spec.Idle = nil
+	_ = client.Update(context.Background(), updated)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if err := client.Get(context.Background(), types.NamespacedName{Name: "app-test-activator", Namespace: "default"}, slice); !errors.IsNotFound(err) {
+		t.Errorf("expected activator EndpointSlice to be deleted, got %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, service)
+	if service.Spec.Selector["app"] != "app-test" {
+		t.Errorf("expected Service to select the pods again, got %v", service.Spec.Selector)
+	}
+}
+
+func TestReconcile_TTL(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "app-test",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:                1,
+			JsonConfig:              `{"posts": []}`,
+			TTLSecondsAfterCreation: ptr.To(int64(24 * 3600)),
+			ExpiresAt:               &metav1.Time{Time: created.Add(2 * time.Hour)},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+		Clock:  clocktesting.NewFakePassiveClock(created.Add(90 * time.Minute)),
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	// The earlier expiresAt applies, the remaining lifetime is refreshed every minute
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("expected requeue after 1m, got %v", result.RequeueAfter)
+	}
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.ExpirationTime == nil || !updated.Status.ExpirationTime.Equal(&metav1.Time{Time: created.Add(2 * time.Hour)}) {
+		t.Errorf("expected expiration at spec.expiresAt, got %v", updated.Status.ExpirationTime)
+	}
+	if updated.Status.RemainingLifetime != "30m" {
+		t.Errorf("expected 30m remaining, got %q", updated.Status.RemainingLifetime)
+	}
+
+	// Expired, the JsonServer is deleted
+	r.Clock = clocktesting.NewFakePassiveClock(created.Add(2 * time.Hour))
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if err := client.Get(context.Background(), req.NamespacedName, updated); !errors.IsNotFound(err) {
+		t.Errorf("expected expired JsonServer to be deleted, got %v", err)
+	}
+}
+
+func TestReconcile_Events(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer, &appsv1.Deployment{}).
+		Build()
+
+	recorder := record.NewFakeRecorder(20)
+	r := &JsonServerReconciler{
+		Client:   client,
+		Scheme:   scheme,
+		Recorder: recorder,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	// drain returns the events emitted so far
+	drain := func() []string {
+		var events []string
+		for {
+			select {
+			case e := <-recorder.Events:
+				events = append(events, e)
+			default:
+				return events
+			}
+		}
+	}
+	expectEvent := func(events []string, want string) {
+		t.Helper()
+		for _, e := range events {
+			if strings.HasPrefix(e, want) {
+				return
+			}
+		}
+		t.Errorf("expected event %q, got %v", want, events)
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	events := drain()
+	expectEvent(events, "Normal Created Created ConfigMap app-test-config-")
+	expectEvent(events, "Normal Created Created Deployment app-test")
+	expectEvent(events, "Normal Created Created Service app-test")
+
+	// Finish the rollout, nothing else changes
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	deployment.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: deployment.Generation,
+		Replicas:           1,
+		ReadyReplicas:      1,
+		AvailableReplicas:  1,
+		UpdatedReplicas:    1,
+	}
+	_ = client.Status().Update(context.Background(), deployment)
+
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	events = drain()
+	if len(events) != 1 {
+		t.Errorf("expected only the rollout to be reported for unchanged objects, got %v", events)
+	}
+	expectEvent(events, "Normal RolloutComplete Deployment app-test rolled out 1 replicas")
+
+	// The rollout is only reported once, a reconcile without changes is silent
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if events := drain(); len(events) != 0 {
+		t.Errorf("expected no events without changes, got %v", events)
+	}
+
+	// Pruned revisions are reported
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	oldConfigMap := "app-test-config-" + updated.Status.ConfigHash
+	updated.Spec.JsonConfig = `{"users": [{"id": 1}]}`
+	updated.Spec.RevisionHistoryLimit = ptr.To[int32](0)
+	_ = client.Update(context.Background(), updated)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	events = drain()
+	expectEvent(events, "Normal Updated Updated Deployment app-test")
+	expectEvent(events, "Normal Deleted Deleted ConfigMap "+oldConfigMap)
+
+	// Invalid JSON is a warning
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	updated.Spec.JsonConfig = `{"users": [`
+	_ = client.Update(context.Background(), updated)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	expectEvent(drain(), "Warning InvalidJSON Error: spec.jsonConfig is not a valid json object")
+}
+
+func TestReconcile_FailureReasons(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+		},
+	}
+
+	// serviceErr is returned by the API server when the Service is created
+	var serviceErr error
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer, &appsv1.Deployment{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if _, ok := obj.(*corev1.Service); ok && serviceErr != nil {
+					return serviceErr
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		}).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: c,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	// A ResourceQuota denial is permanent and reported with the API message
+	serviceErr = errors.NewForbidden(schema.GroupResource{Resource: "services"}, "app-test",
+		fmt.Errorf("exceeded quota: mocks, requested: services=1, used: services=5, limited: services=5"))
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Errorf("expected a quota failure not to be retried, got %v", err)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = c.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.State != "Error" || updated.Status.Reason != examplev1.FailureReasonQuotaExceeded {
+		t.Errorf("expected Error state with reason QuotaExceeded, got %q, %q", updated.Status.State, updated.Status.Reason)
+	}
+	if !strings.Contains(updated.Status.Message, "exceeded quota: mocks, requested: services=1") {
+		t.Errorf("expected the API message in status, got %q", updated.Status.Message)
+	}
+	ready := meta.FindStatusCondition(updated.Status.Conditions, examplev1.ConditionReady)
+	if ready == nil || ready.Reason != examplev1.ReasonReconcileFailed {
+		t.Errorf("expected Ready reason ReconcileFailed, got %v", ready)
+	}
+
+	// An unavailable API server is transient and retried with backoff
+	serviceErr = errors.NewServiceUnavailable("etcdserver: request timed out")
+	_, err = r.Reconcile(context.Background(), req)
+	if err == nil {
+		t.Error("expected a transient failure to be returned for retry")
+	}
+	_ = c.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.Reason != examplev1.FailureReasonTransient {
+		t.Errorf("expected reason Transient, got %q", updated.Status.Reason)
+	}
+
+	// The reason is cleared once the Service can be created
+	serviceErr = nil
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = c.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.State == "Error" || updated.Status.Reason != "" {
+		t.Errorf("expected the failure to be cleared, got %q, %q", updated.Status.State, updated.Status.Reason)
+	}
+}
+
+func TestReconcile_Metrics(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	clock := clocktesting.NewFakePassiveClock(time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC))
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "app-test",
+			Namespace:         "metrics",
+			Generation:        1,
+			CreationTimestamp: metav1.NewTime(clock.Now()),
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer, &appsv1.Deployment{}).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+		Clock:  clock,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "metrics",
+		},
+	}
+
+	// histogram returns the sample count and sum of a histogram series
+	histogram := func(o prometheus.Observer) (uint64, float64) {
+		m := &dto.Metric{}
+		_ = o.(prometheus.Metric).Write(m)
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+	}
+
+	deploymentSteps, _ := histogram(reconcileStepDuration.WithLabelValues(stepDeployment))
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(configSizeBytes.WithLabelValues("metrics", "app-test")); got != float64(len(`{"users": []}`)) {
+		t.Errorf("expected config size of %d bytes, got %v", len(`{"users": []}`), got)
+	}
+	if got, _ := histogram(reconcileStepDuration.WithLabelValues(stepDeployment)); got != deploymentSteps+1 {
+		t.Errorf("expected one more deployment step duration, got %d", got-deploymentSteps)
+	}
+
+	expected := `
+# HELP jsonserver_count Number of JsonServers per namespace and status.state
+# TYPE jsonserver_count gauge
+jsonserver_count{namespace="metrics",state="Error"} 0
+jsonserver_count{namespace="metrics",state="Idle"} 0
+jsonserver_count{namespace="metrics",state="Progressing"} 1
+jsonserver_count{namespace="metrics",state="Suspended"} 0
+jsonserver_count{namespace="metrics",state="Synced"} 0
+`
+	if err := testutil.CollectAndCompare(&stateCollector{reader: client}, strings.NewReader(expected), "jsonserver_count"); err != nil {
+		t.Error(err)
+	}
+
+	// Finish the rollout 90 seconds after the JsonServer was created
+	clock.SetTime(clock.Now().Add(90 * time.Second))
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	deployment.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: deployment.Generation,
+		Replicas:           1,
+		ReadyReplicas:      1,
+		AvailableReplicas:  1,
+		UpdatedReplicas:    1,
+	}
+	if err := client.Status().Update(context.Background(), deployment); err != nil {
+		t.Fatalf("failed to update deployment status: %v", err)
+	}
+
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	if count, sum := histogram(timeToReady.WithLabelValues("metrics")); count != 1 || sum != 90 {
+		t.Errorf("expected one rollout ready after 90s, got %d rollouts taking %vs", count, sum)
+	}
+
+	// The per-object metrics are dropped with the JsonServer
+	_ = client.Delete(context.Background(), jsonServer)
+	_, _ = r.Reconcile(context.Background(), req)
+	if configSizeBytes.DeleteLabelValues("metrics", "app-test") {
+		t.Error("expected the config size series to be deleted with the JsonServer")
+	}
+}
+
+func TestReconcile_GoRuntime(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:       1,
+			JsonConfig:     `{"users": []}`,
+			Runtime:        examplev1.RuntimeGo,
+			ReloadStrategy: examplev1.ReloadStrategyInPlace,
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer, &appsv1.Deployment{}).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	// Without the controller image the go runtime cannot run
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	ready := meta.FindStatusCondition(updated.Status.Conditions, examplev1.ConditionReady)
+	if ready == nil || ready.Reason != examplev1.ReasonGoRuntimeUnavailable {
+		t.Errorf("expected Ready reason %s, got %+v", examplev1.ReasonGoRuntimeUnavailable, ready)
+	}
+
+	r.GoRuntimeImage = "registry.internal/json-server-controller:1.2.0"
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if container.Image != "registry.internal/json-server-controller:1.2.0" {
+		t.Errorf("expected the controller image, got %s", container.Image)
+	}
+	if strings.Join(container.Command, " ") != "/manager serve" {
+		t.Errorf("expected the serve command, got %v", container.Command)
+	}
+	if strings.Join(container.Args, " ") != "--port 3000 --watch /data/db.json" {
+		t.Errorf("expected flags before the data file, got %v", container.Args)
+	}
+}
+
+func TestReconcile_Routes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"users": []}`,
+			Routes: map[string]string{
+				"/api/v2/*": "/$1",
+			},
+			Storage: &examplev1.StorageSpec{Mode: examplev1.StorageModePersistent},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	updated := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	configMap := &corev1.ConfigMap{}
+	_ = client.Get(context.Background(), types.NamespacedName{
+		Name:      "app-test-config-" + updated.Status.ConfigHash,
+		Namespace: "default",
+	}, configMap)
+	if configMap.Data["routes.json"] != "{\n  \"/api/v2/*\": \"/$1\"\n}" {
+		t.Errorf("expected routes.json in the configmap, got %q", configMap.Data["routes.json"])
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	podSpec := deployment.Spec.Template.Spec
+	if strings.Join(podSpec.Containers[0].Args, " ") != "/data/db.json --port 3000 --routes /data/routes.json" {
+		t.Errorf("expected the routes flag, got %v", podSpec.Containers[0].Args)
+	}
+	// The data volume gets routes.json from the init container
+	if script := podSpec.InitContainers[0].Command[2]; !strings.HasSuffix(script, "; fi && cp /seed/routes.json /data/routes.json") {
+		t.Errorf("expected the init container to copy routes.json, got %q", script)
+	}
+
+	// Changing the routes creates a new revision
+	previous := updated.Status.ConfigHash
+	updated.Spec.Routes = map[string]string{"/api/v3/*": "/$1"}
+	_ = client.Update(context.Background(), updated)
+	_, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.ConfigHash == previous {
+		t.Error("expected a routes change to create a new revision")
+	}
+}
+
+func TestReconcile_Probes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = networkingv1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"people": [{"id": 1}], "profile": {}}`,
+			Probes: &examplev1.ProbesSpec{
+				Liveness: &corev1.Probe{PeriodSeconds: 60},
+				Readiness: &corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{
+						TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("http")},
+					},
+				},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer).
+		WithStatusSubresource(jsonServer).
+		Build()
+
+	r := &JsonServerReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	_ = client.Get(context.Background(), req.NamespacedName, deployment)
+	container := deployment.Spec.Template.Spec.Containers[0]
+
+	// The startup probe keeps the default, limited to one item of the first collection
+	startup := container.StartupProbe
+	if startup == nil || startup.HTTPGet == nil || startup.HTTPGet.Path != "/people?_limit=1" || startup.FailureThreshold != 30 {
+		t.Errorf("expected the default startup probe on /people?_limit=1, got %+v", startup)
+	}
+
+	// Overrides without a handler keep the default handler
+	liveness := container.LivenessProbe
+	if liveness == nil || liveness.HTTPGet == nil || liveness.HTTPGet.Path != "/people?_limit=1" || liveness.PeriodSeconds != 60 || liveness.FailureThreshold != 3 {
+		t.Errorf("expected the liveness override to be merged into the default, got %+v", liveness)
+	}
+
+	// Overrides with a handler replace the default handler
+	readiness := container.ReadinessProbe
+	if readiness == nil || readiness.HTTPGet != nil || readiness.TCPSocket == nil || readiness.PeriodSeconds != 10 {
+		t.Errorf("expected the readiness override to use a TCP check, got %+v", readiness)
+	}
 }
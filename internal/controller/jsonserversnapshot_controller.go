@@ -0,0 +1,344 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+const (
+	// snapshotRetryInterval is how often a pending snapshot checks its JsonServer again
+	snapshotRetryInterval = 10 * time.Second
+
+	// snapshotTimeout bounds the request reading /db when no HTTP client is configured
+	snapshotTimeout = 30 * time.Second
+
+	// maxSnapshotSize is the largest /db response read from a JsonServer
+	maxSnapshotSize = 16 * 1024 * 1024
+
+	// snapshotLabel is set to the snapshot name on the object holding its data
+	snapshotLabel = "example.com/snapshot"
+)
+
+// JsonServerSnapshotReconciler reconciles a JsonServerSnapshot object
+type JsonServerSnapshotReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// HTTPClient is used to read /db from the JsonServer Service
+	HTTPClient *http.Client
+
+	// APIReader reads snapshot Secrets from the API server, so that they are
+	// not cached. Defaults to the client
+	APIReader client.Reader
+}
+
+// +kubebuilder:rbac:groups=example.com,resources=jsonserversnapshots,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=example.com,resources=jsonserversnapshots/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=example.com,resources=jsonserversnapshots/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create
+
+// Reconcile captures the live data of the referenced JsonServer once and
+// stores it in a ConfigMap or Secret owned by the snapshot.
+func (r *JsonServerSnapshotReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// Fetch the JsonServerSnapshot instance
+	snapshot := &examplecomv1.JsonServerSnapshot{}
+	err := r.Get(ctx, req.NamespacedName, snapshot)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("JsonServerSnapshot resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get JsonServerSnapshot")
+		return ctrl.Result{}, err
+	}
+
+	// A snapshot is taken only once
+	if snapshot.Status.Phase == examplecomv1.SnapshotPhaseCompleted || snapshot.Status.Phase == examplecomv1.SnapshotPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	// Data left by an earlier attempt whose status update failed
+	stored, err := r.storedData(ctx, snapshot)
+	if err == nil {
+		return r.completeSnapshot(ctx, snapshot, stored)
+	}
+	if !errors.IsNotFound(err) {
+		return r.failSnapshot(ctx, snapshot, fmt.Sprintf("Error: %v", err))
+	}
+
+	// Wait for the JsonServer to serve requests
+	jsonServer := &examplecomv1.JsonServer{}
+	err = r.Get(ctx, types.NamespacedName{Name: snapshot.Spec.JsonServerName, Namespace: snapshot.Namespace}, jsonServer)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.pendingSnapshot(ctx, snapshot, fmt.Sprintf("Waiting for JsonServer %s to exist", snapshot.Spec.JsonServerName))
+		}
+		logger.Error(err, "Failed to get JsonServer")
+		return ctrl.Result{}, err
+	}
+	if jsonServer.Spec.Suspend {
+		return r.pendingSnapshot(ctx, snapshot, fmt.Sprintf("Waiting for JsonServer %s to be resumed", jsonServer.Name))
+	}
+	if jsonServer.Status.IdleSince != nil {
+		// Reading /db counts as a request, record it like the activator does
+		if err := recordRequest(ctx, r.Client, jsonServer); err != nil {
+			logger.Error(err, "Failed to wake JsonServer")
+			return ctrl.Result{}, err
+		}
+		return r.pendingSnapshot(ctx, snapshot, fmt.Sprintf("Waiting for idle JsonServer %s to wake up", jsonServer.Name))
+	}
+	if jsonServer.Status.ReadyReplicas == 0 {
+		return r.pendingSnapshot(ctx, snapshot, fmt.Sprintf("Waiting for JsonServer %s to have ready pods", jsonServer.Name))
+	}
+
+	// Read the live data through the Service
+	url := internalURL(jsonServer) + "/db"
+	data, err := r.fetchData(ctx, url)
+	if err != nil {
+		logger.Info("Failed to read JsonServer data, retrying", "URL", url, "error", err.Error())
+		return r.pendingSnapshot(ctx, snapshot, fmt.Sprintf("Failed to read %s: %v", url, err))
+	}
+
+	var js interface{}
+	if err := json.Unmarshal(data, &js); err != nil {
+		return r.failSnapshot(ctx, snapshot, fmt.Sprintf("Error: %s did not return valid JSON", url))
+	}
+
+	// Store the data, compressed when it is large
+	key, value := "db.json", data
+	if len(data) > examplecomv1.ConfigCompressionThreshold {
+		compressed, err := compressData(data)
+		if err != nil {
+			logger.Error(err, "Failed to compress snapshot")
+			return ctrl.Result{}, err
+		}
+		if len(compressed) > maxConfigMapPayload {
+			return r.failSnapshot(ctx, snapshot, fmt.Sprintf("Error: the data is %d bytes compressed and does not fit into one %s", len(compressed), snapshotTarget(snapshot)))
+		}
+		key, value = "db.json.gz", compressed
+	}
+
+	if err := r.createDataObject(ctx, snapshot, key, value); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return r.failSnapshot(ctx, snapshot, fmt.Sprintf("Error: %s %s already exists and is not owned by the snapshot", snapshotTarget(snapshot), snapshot.Name))
+		}
+		logger.Error(err, "Failed to store snapshot")
+		return ctrl.Result{}, err
+	}
+	logger.Info("Snapshot stored", "Kind", snapshotTarget(snapshot), "Name", snapshot.Name, "Size", len(data))
+
+	return r.completeSnapshot(ctx, snapshot, string(data))
+}
+
+// fetchData reads the complete database from json-server
+func (r *JsonServerSnapshotReconciler) fetchData(ctx context.Context, url string) ([]byte, error) {
+	httpClient := r.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: snapshotTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSnapshotSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSnapshotSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxSnapshotSize)
+	}
+	return data, nil
+}
+
+// createDataObject creates the immutable ConfigMap or Secret holding the snapshot data
+func (r *JsonServerSnapshotReconciler) createDataObject(ctx context.Context, snapshot *examplecomv1.JsonServerSnapshot, key string, value []byte) error {
+	objectMeta := metav1.ObjectMeta{
+		Name:      snapshot.Name,
+		Namespace: snapshot.Namespace,
+		Labels: map[string]string{
+			"app.kubernetes.io/name":       snapshot.Spec.JsonServerName,
+			"app.kubernetes.io/managed-by": "json-server-controller",
+			snapshotLabel:                  snapshot.Name,
+		},
+	}
+
+	var obj client.Object
+	if snapshotTarget(snapshot) == examplecomv1.SnapshotTargetSecret {
+		obj = &corev1.Secret{
+			ObjectMeta: objectMeta,
+			Immutable:  ptr.To(true),
+			Data:       map[string][]byte{key: value},
+		}
+	} else {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: objectMeta,
+			Immutable:  ptr.To(true),
+		}
+		if key == "db.json" {
+			configMap.Data = map[string]string{key: string(value)}
+		} else {
+			configMap.BinaryData = map[string][]byte{key: value}
+		}
+		obj = configMap
+	}
+
+	// Set the owner reference
+	if err := controllerutil.SetControllerReference(snapshot, obj, r.Scheme); err != nil {
+		return err
+	}
+	return r.Create(ctx, obj)
+}
+
+// storedData returns the data already stored for the snapshot. It returns a
+// NotFound error when nothing is stored yet.
+func (r *JsonServerSnapshotReconciler) storedData(ctx context.Context, snapshot *examplecomv1.JsonServerSnapshot) (string, error) {
+	data, owner, err := loadSnapshotObject(ctx, r.Client, apiReader(r.Client, r.APIReader), snapshot.Namespace, snapshotTarget(snapshot), snapshot.Name)
+	if err != nil {
+		return "", err
+	}
+	if !metav1.IsControlledBy(owner, snapshot) {
+		return "", fmt.Errorf("%s %s already exists and is not owned by the snapshot", snapshotTarget(snapshot), snapshot.Name)
+	}
+	return data, nil
+}
+
+// completeSnapshot records the captured data in the snapshot status
+func (r *JsonServerSnapshotReconciler) completeSnapshot(ctx context.Context, snapshot *examplecomv1.JsonServerSnapshot, data string) (ctrl.Result, error) {
+	now := metav1.Now()
+	snapshot.Status.Phase = examplecomv1.SnapshotPhaseCompleted
+	snapshot.Status.Message = fmt.Sprintf("Captured %d bytes from JsonServer %s", len(data), snapshot.Spec.JsonServerName)
+	snapshot.Status.DataName = snapshot.Name
+	snapshot.Status.Size = int64(len(data))
+	snapshot.Status.CapturedAt = &now
+	snapshot.Status.Resources = summarizeResources(data)
+
+	if err := r.Status().Update(ctx, snapshot); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update JsonServerSnapshot status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// pendingSnapshot records why the snapshot is still pending and retries later
+func (r *JsonServerSnapshotReconciler) pendingSnapshot(ctx context.Context, snapshot *examplecomv1.JsonServerSnapshot, message string) (ctrl.Result, error) {
+	snapshot.Status.Phase = examplecomv1.SnapshotPhasePending
+	snapshot.Status.Message = message
+
+	if err := r.Status().Update(ctx, snapshot); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update JsonServerSnapshot status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: snapshotRetryInterval}, nil
+}
+
+// failSnapshot marks the snapshot as failed, it is not retried
+func (r *JsonServerSnapshotReconciler) failSnapshot(ctx context.Context, snapshot *examplecomv1.JsonServerSnapshot, message string) (ctrl.Result, error) {
+	snapshot.Status.Phase = examplecomv1.SnapshotPhaseFailed
+	snapshot.Status.Message = message
+
+	if err := r.Status().Update(ctx, snapshot); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update JsonServerSnapshot status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// snapshotTarget returns the kind of object the snapshot is stored in
+func snapshotTarget(snapshot *examplecomv1.JsonServerSnapshot) examplecomv1.SnapshotTarget {
+	if snapshot.Spec.Target == "" {
+		return examplecomv1.SnapshotTargetConfigMap
+	}
+	return snapshot.Spec.Target
+}
+
+// readSnapshotData returns the db.json content captured by a completed snapshot
+func readSnapshotData(ctx context.Context, c client.Client, secrets client.Reader, snapshot *examplecomv1.JsonServerSnapshot) (string, error) {
+	data, _, err := loadSnapshotObject(ctx, c, secrets, snapshot.Namespace, snapshotTarget(snapshot), snapshot.Status.DataName)
+	return data, err
+}
+
+// loadSnapshotObject reads db.json, or the compressed db.json.gz, from the
+// ConfigMap or Secret holding a snapshot and returns it together with the
+// object. Secrets are read with secrets, ConfigMaps with c
+func loadSnapshotObject(ctx context.Context, c client.Client, secrets client.Reader, namespace string, target examplecomv1.SnapshotTarget, name string) (string, client.Object, error) {
+	key := types.NamespacedName{Name: name, Namespace: namespace}
+
+	var plain string
+	var compressed []byte
+	var obj client.Object
+	if target == examplecomv1.SnapshotTargetSecret {
+		secret := &corev1.Secret{}
+		if err := secrets.Get(ctx, key, secret); err != nil {
+			return "", nil, err
+		}
+		plain, compressed, obj = string(secret.Data["db.json"]), secret.Data["db.json.gz"], secret
+	} else {
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, key, configMap); err != nil {
+			return "", nil, err
+		}
+		plain, compressed, obj = configMap.Data["db.json"], configMap.BinaryData["db.json.gz"], configMap
+	}
+
+	if len(compressed) == 0 {
+		return plain, obj, nil
+	}
+	data, err := decompressChunks([][]byte{compressed})
+	if err != nil {
+		return "", nil, fmt.Errorf("%s %s: %w", target, name, err)
+	}
+	return data, obj, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *JsonServerSnapshotReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&examplecomv1.JsonServerSnapshot{}).
+		Complete(r)
+}
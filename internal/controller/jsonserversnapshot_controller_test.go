@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	examplev1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// redirectTransport sends every request to the test server
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSnapshotReconcile_CapturesData(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.Host + r.URL.Path
+		_, _ = w.Write([]byte(`{"posts": [{"id": 1}, {"id": 2}], "profile": {"name": "x"}}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"posts": []}`,
+		},
+		Status: examplev1.JsonServerStatus{
+			ReadyReplicas: 1,
+		},
+	}
+
+	snapshot := &examplev1.JsonServerSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test-snapshot",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSnapshotSpec{
+			JsonServerName: "app-test",
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer, snapshot).
+		WithStatusSubresource(jsonServer, snapshot).
+		Build()
+
+	r := &JsonServerSnapshotReconciler{
+		Client:     client,
+		Scheme:     scheme,
+		HTTPClient: &http.Client{Transport: &redirectTransport{target: target}},
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test-snapshot",
+			Namespace: "default",
+		},
+	}
+
+	_, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	if requested != "app-test.default.svc:3000/db" {
+		t.Errorf("expected /db to be read through the Service, got %s", requested)
+	}
+
+	updated := &examplev1.JsonServerSnapshot{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.Phase != examplev1.SnapshotPhaseCompleted {
+		t.Fatalf("expected phase Completed, got %s: %s", updated.Status.Phase, updated.Status.Message)
+	}
+	if updated.Status.CapturedAt == nil || updated.Status.Size == 0 {
+		t.Errorf("expected size and capture time in status, got %+v", updated.Status)
+	}
+	if len(updated.Status.Resources) != 2 || updated.Status.Resources[0].Count != 2 {
+		t.Errorf("expected collection counts in status, got %+v", updated.Status.Resources)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = client.Get(context.Background(), req.NamespacedName, configMap)
+	if err != nil {
+		t.Fatalf("expected snapshot configmap: %v", err)
+	}
+	if !metav1.IsControlledBy(configMap, updated) {
+		t.Error("expected the snapshot to own its configmap")
+	}
+	if configMap.Data["db.json"] == "" {
+		t.Error("expected db.json in the snapshot configmap")
+	}
+}
+
+func TestSnapshotReconcile_WaitsForReadyPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			JsonConfig: `{"posts": []}`,
+		},
+	}
+
+	snapshot := &examplev1.JsonServerSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test-snapshot",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSnapshotSpec{
+			JsonServerName: "app-test",
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer, snapshot).
+		WithStatusSubresource(jsonServer, snapshot).
+		Build()
+
+	r := &JsonServerSnapshotReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test-snapshot",
+			Namespace: "default",
+		},
+	}
+
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected a pending snapshot to be requeued")
+	}
+
+	updated := &examplev1.JsonServerSnapshot{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.Phase != examplev1.SnapshotPhasePending {
+		t.Errorf("expected phase Pending, got %s", updated.Status.Phase)
+	}
+}
+
+func TestSnapshotReconcile_WakesIdleJsonServer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = examplev1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	lastRequest := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	jsonServer := &examplev1.JsonServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-test",
+			Namespace:   "default",
+			Annotations: map[string]string{examplev1.LastRequestAtAnnotation: lastRequest},
+		},
+		Spec: examplev1.JsonServerSpec{
+			Replicas:   1,
+			Idle:       &examplev1.IdleSpec{AfterMinutes: 30},
+			JsonConfig: `{"posts": []}`,
+		},
+		Status: examplev1.JsonServerStatus{
+			IdleSince: &metav1.Time{Time: time.Now().Add(-90 * time.Minute)},
+		},
+	}
+
+	snapshot := &examplev1.JsonServerSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-test-snapshot",
+			Namespace: "default",
+		},
+		Spec: examplev1.JsonServerSnapshotSpec{
+			JsonServerName: "app-test",
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(jsonServer, snapshot).
+		WithStatusSubresource(jsonServer, snapshot).
+		Build()
+
+	r := &JsonServerSnapshotReconciler{
+		Client: client,
+		Scheme: scheme,
+	}
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "app-test-snapshot",
+			Namespace: "default",
+		},
+	}
+
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Error("expected a pending snapshot to be requeued")
+	}
+
+	// The snapshot counts as a request, which scales the JsonServer up again
+	woken := &examplev1.JsonServer{}
+	_ = client.Get(context.Background(), types.NamespacedName{Name: "app-test", Namespace: "default"}, woken)
+	if woken.Annotations[examplev1.LastRequestAtAnnotation] == lastRequest {
+		t.Error("expected the snapshot to record a request on the idle JsonServer")
+	}
+
+	updated := &examplev1.JsonServerSnapshot{}
+	_ = client.Get(context.Background(), req.NamespacedName, updated)
+	if updated.Status.Phase != examplev1.SnapshotPhasePending || !strings.Contains(updated.Status.Message, "wake up") {
+		t.Errorf("expected phase Pending while the JsonServer wakes up, got %s %q", updated.Status.Phase, updated.Status.Message)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// Reconcile steps reported by jsonserver_reconcile_step_duration_seconds
+const (
+	stepConfigMap  = "configmap"
+	stepStorage    = "storage"
+	stepDeployment = "deployment"
+	stepService    = "service"
+	stepExpose     = "expose"
+)
+
+// jsonServerStates are the values of status.state counted by jsonserver_count
+var jsonServerStates = []string{"Synced", "Progressing", "Suspended", "Idle", "Error"}
+
+var (
+	reconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jsonserver_reconcile_step_duration_seconds",
+		Help:    "Duration of the steps of a JsonServer reconcile",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"step"})
+
+	configSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jsonserver_config_size_bytes",
+		Help: "Size of the JSON data served by a JsonServer",
+	}, []string{"namespace", "name"})
+
+	timeToReady = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "jsonserver_time_to_ready_seconds",
+		Help: "Time from a JsonServer spec change to the completed rollout",
+		// 1s to about 1h
+		Buckets: prometheus.ExponentialBuckets(1, 2, 13),
+	}, []string{"namespace"})
+
+	jsonServerCountDesc = prometheus.NewDesc(
+		"jsonserver_count",
+		"Number of JsonServers per namespace and status.state",
+		[]string{"namespace", "state"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcileStepDuration, configSizeBytes, timeToReady)
+}
+
+// observeStep records the duration of a reconcile step started at start
+func observeStep(step string, start time.Time) {
+	reconcileStepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+}
+
+// rolloutStart is the generation of a JsonServer and when it was first reconciled
+type rolloutStart struct {
+	generation int64
+	at         time.Time
+}
+
+// trackRollout remembers when a new generation of the JsonServer is first
+// reconciled, so that observeRollout can report the time until it is ready.
+// Rollouts in progress when the controller starts are not reported.
+func (r *JsonServerReconciler) trackRollout(jsonServer *examplecomv1.JsonServer) {
+	if jsonServer.Status.ObservedGeneration == jsonServer.Generation {
+		return
+	}
+	key := client.ObjectKeyFromObject(jsonServer)
+	if v, ok := r.rollouts.Load(key); ok && v.(rolloutStart).generation == jsonServer.Generation {
+		return
+	}
+
+	// A JsonServer that was never reconciled changed when it was created
+	at := r.now()
+	if jsonServer.Status.ObservedGeneration == 0 && !jsonServer.CreationTimestamp.IsZero() {
+		at = jsonServer.CreationTimestamp.Time
+	}
+	r.rollouts.Store(key, rolloutStart{generation: jsonServer.Generation, at: at})
+}
+
+// observeRollout reports the time from the spec change to the completed rollout
+func (r *JsonServerReconciler) observeRollout(jsonServer *examplecomv1.JsonServer) {
+	v, ok := r.rollouts.LoadAndDelete(client.ObjectKeyFromObject(jsonServer))
+	if !ok || v.(rolloutStart).generation != jsonServer.Generation {
+		return
+	}
+	timeToReady.WithLabelValues(jsonServer.Namespace).Observe(r.now().Sub(v.(rolloutStart).at).Seconds())
+}
+
+// forgetMetrics drops the per-object metrics of a deleted JsonServer
+func (r *JsonServerReconciler) forgetMetrics(key types.NamespacedName) {
+	r.rollouts.Delete(key)
+	configSizeBytes.DeleteLabelValues(key.Namespace, key.Name)
+}
+
+// stateCollector counts the JsonServers in the cache per namespace and state
+// on every scrape
+type stateCollector struct {
+	reader client.Reader
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jsonServerCountDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	list := &examplecomv1.JsonServerList{}
+	if err := c.reader.List(ctx, list); err != nil {
+		ch <- prometheus.NewInvalidMetric(jsonServerCountDesc, err)
+		return
+	}
+
+	// Every state is reported for namespaces with JsonServers, so that alerts see zeros
+	counts := map[string]map[string]int{}
+	for _, jsonServer := range list.Items {
+		if counts[jsonServer.Namespace] == nil {
+			counts[jsonServer.Namespace] = map[string]int{}
+		}
+		if jsonServer.Status.State != "" {
+			counts[jsonServer.Namespace][jsonServer.Status.State]++
+		}
+	}
+	for namespace, states := range counts {
+		for _, state := range jsonServerStates {
+			ch <- prometheus.MustNewConstMetric(jsonServerCountDesc, prometheus.GaugeValue, float64(states[state]), namespace, state)
+		}
+	}
+}
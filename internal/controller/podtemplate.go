@@ -0,0 +1,143 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// defaultRunAsUser is the uid of the "node" user in the json-server image
+const defaultRunAsUser int64 = 1000
+
+// defaultResources returns the json-server container resources used when
+// spec.podTemplate.resources is not set
+func defaultResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+	}
+}
+
+// defaultSecurityContext returns a container security context that satisfies
+// the restricted Pod Security Standard
+func defaultSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		RunAsNonRoot:             ptr.To(true),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// defaultPodSecurityContext returns a pod security context that satisfies
+// the restricted Pod Security Standard. The json-server image and its
+// mirrors name their user, so runAsNonRoot needs a numeric uid to be
+// checked by the kubelet. fsGroup makes persistent volumes writable for it.
+func defaultPodSecurityContext() *corev1.PodSecurityContext {
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: ptr.To(true),
+		RunAsUser:    ptr.To(defaultRunAsUser),
+		RunAsGroup:   ptr.To(defaultRunAsUser),
+		FSGroup:      ptr.To(defaultRunAsUser),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// applyPodTemplate merges spec.podTemplate into the generated pod template,
+// falling back to secure defaults for everything the user did not set
+func applyPodTemplate(template *corev1.PodTemplateSpec, jsonServer *examplecomv1.JsonServer) {
+	overrides := jsonServer.Spec.PodTemplate
+	if overrides == nil {
+		overrides = &examplecomv1.PodTemplateOverrides{}
+	}
+
+	// Labels and annotations, the selector label always wins
+	if len(overrides.Labels) > 0 {
+		labels := make(map[string]string, len(overrides.Labels)+len(template.Labels))
+		for k, v := range overrides.Labels {
+			labels[k] = v
+		}
+		for k, v := range template.Labels {
+			labels[k] = v
+		}
+		template.Labels = labels
+	}
+	if len(overrides.Annotations) > 0 {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		for k, v := range overrides.Annotations {
+			if _, ok := template.Annotations[k]; !ok {
+				template.Annotations[k] = v
+			}
+		}
+	}
+
+	// Scheduling
+	podSpec := &template.Spec
+	podSpec.NodeSelector = overrides.NodeSelector
+	podSpec.Tolerations = overrides.Tolerations
+	podSpec.Affinity = overrides.Affinity
+	podSpec.TopologySpreadConstraints = overrides.TopologySpreadConstraints
+	podSpec.PriorityClassName = overrides.PriorityClassName
+
+	// Security
+	securityContext := defaultSecurityContext()
+	if overrides.SecurityContext != nil {
+		securityContext = overrides.SecurityContext
+	}
+
+	podSpec.SecurityContext = defaultPodSecurityContext()
+	if overrides.PodSecurityContext != nil {
+		podSpec.SecurityContext = overrides.PodSecurityContext
+		// Keep the default uid unless the overrides set one
+		if podSpec.SecurityContext.RunAsUser == nil && securityContext.RunAsUser == nil {
+			podSpec.SecurityContext = podSpec.SecurityContext.DeepCopy()
+			podSpec.SecurityContext.RunAsUser = ptr.To(defaultRunAsUser)
+		}
+	}
+
+	resources := defaultResources()
+	if overrides.Resources != nil {
+		resources = *overrides.Resources
+	}
+
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].SecurityContext = securityContext
+		if podSpec.Containers[i].Name == "json-server" {
+			podSpec.Containers[i].Resources = resources
+		}
+	}
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].SecurityContext = securityContext
+	}
+}
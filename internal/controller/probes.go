@@ -0,0 +1,99 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// probePath returns the path probed on json-server: the first top-level
+// resource in document order, or "/" when there is none. Collections are
+// limited to one item so that probes stay cheap on large datasets.
+func probePath(resources []examplecomv1.ResourceSummary) string {
+	if len(resources) == 0 || resources[0].Name == "" {
+		return "/"
+	}
+	path := "/" + url.PathEscape(resources[0].Name)
+	if resources[0].Kind == examplecomv1.ResourceKindArray {
+		path += "?_limit=1"
+	}
+	return path
+}
+
+// httpProbe returns an HTTP GET probe against the json-server port
+func httpProbe(path string, periodSeconds, failureThreshold int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString("http"),
+			},
+		},
+		TimeoutSeconds:   2,
+		PeriodSeconds:    periodSeconds,
+		FailureThreshold: failureThreshold,
+	}
+}
+
+// mergeProbe returns the override with its empty fields taken from the
+// default probe, so that e.g. only periodSeconds can be changed
+func mergeProbe(defaults, override *corev1.Probe) *corev1.Probe {
+	if override == nil {
+		return defaults
+	}
+
+	probe := override.DeepCopy()
+	handler := probe.ProbeHandler
+	if handler.Exec == nil && handler.HTTPGet == nil && handler.TCPSocket == nil && handler.GRPC == nil {
+		probe.ProbeHandler = defaults.ProbeHandler
+	}
+	if probe.TimeoutSeconds == 0 {
+		probe.TimeoutSeconds = defaults.TimeoutSeconds
+	}
+	if probe.PeriodSeconds == 0 {
+		probe.PeriodSeconds = defaults.PeriodSeconds
+	}
+	if probe.FailureThreshold == 0 {
+		probe.FailureThreshold = defaults.FailureThreshold
+	}
+	return probe
+}
+
+// applyProbes sets the liveness, readiness and startup probes of the
+// json-server container, merging spec.probes into the defaults.
+// The default path comes from the resources summarized into status.
+func applyProbes(container *corev1.Container, jsonServer *examplecomv1.JsonServer) {
+	path := probePath(jsonServer.Status.Resources)
+
+	// The startup probe allows up to a minute for json-server to load db.json
+	container.StartupProbe = httpProbe(path, 2, 30)
+	container.ReadinessProbe = httpProbe(path, 10, 3)
+	container.LivenessProbe = httpProbe(path, 20, 3)
+
+	overrides := jsonServer.Spec.Probes
+	if overrides == nil {
+		return
+	}
+	container.StartupProbe = mergeProbe(container.StartupProbe, overrides.Startup)
+	container.ReadinessProbe = mergeProbe(container.ReadinessProbe, overrides.Readiness)
+	container.LivenessProbe = mergeProbe(container.LivenessProbe, overrides.Liveness)
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestProbePath(t *testing.T) {
+	tests := []struct {
+		jsonConfig string
+		want       string
+	}{
+		{`{"users": [], "posts": []}`, "/users?_limit=1"},
+		{`{"zebras": {}, "apples": []}`, "/zebras"},
+		{`{}`, "/"},
+		{`[]`, "/"},
+		{`{"my posts": []}`, "/my%20posts?_limit=1"},
+	}
+
+	for _, tt := range tests {
+		if got := probePath(summarizeResources(tt.jsonConfig)); got != tt.want {
+			t.Errorf("probePath(%s) = %s, want %s", tt.jsonConfig, got, tt.want)
+		}
+	}
+}
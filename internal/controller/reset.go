@@ -0,0 +1,105 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// resetAtAnnotation is set on the pod template to the time of the last reset,
+// so that every reset restarts the pods
+const resetAtAnnotation = "example.com/reset-at"
+
+// reconcileReset records a data reset in the status when the
+// example.com/reset-requested-at annotation changed or spec.resetSchedule is
+// due. The reset itself happens through the pod template, see resetToken.
+// It returns the time until the next scheduled reset, or zero without a schedule.
+func (r *JsonServerReconciler) reconcileReset(ctx context.Context, jsonServer *examplecomv1.JsonServer) (time.Duration, error) {
+	now := r.now()
+	status := &jsonServer.Status
+
+	// Reset on request
+	requested := jsonServer.Annotations[examplecomv1.ResetRequestedAtAnnotation]
+	if requested != "" && requested != status.ObservedResetRequest {
+		log.FromContext(ctx).Info("Resetting data on request", "requestedAt", requested)
+		status.ObservedResetRequest = requested
+		status.LastResetTime = &metav1.Time{Time: now}
+	}
+
+	if jsonServer.Spec.ResetSchedule == "" {
+		return 0, nil
+	}
+
+	// Reset on schedule. Missed schedules result in a single reset.
+	schedule, err := cron.ParseStandard(jsonServer.Spec.ResetSchedule)
+	if err != nil {
+		return 0, fmt.Errorf("spec.resetSchedule: %w", err)
+	}
+	if !scheduledReset(schedule, jsonServer).After(now) {
+		log.FromContext(ctx).Info("Resetting data on schedule", "schedule", jsonServer.Spec.ResetSchedule)
+		status.LastResetTime = &metav1.Time{Time: now}
+	}
+
+	return scheduledReset(schedule, jsonServer).Sub(now), nil
+}
+
+// untilReset returns the time until the next scheduled reset recorded in the
+// status, or zero without a valid schedule or when the reset is already due
+func (r *JsonServerReconciler) untilReset(jsonServer *examplecomv1.JsonServer) time.Duration {
+	if jsonServer.Spec.ResetSchedule == "" {
+		return 0
+	}
+	schedule, err := cron.ParseStandard(jsonServer.Spec.ResetSchedule)
+	if err != nil {
+		return 0
+	}
+	return scheduledReset(schedule, jsonServer).Sub(r.now())
+}
+
+// scheduledReset returns the first scheduled reset after the last one, or
+// after the creation of a JsonServer that was never reset
+func scheduledReset(schedule cron.Schedule, jsonServer *examplecomv1.JsonServer) time.Time {
+	last := jsonServer.CreationTimestamp.Time
+	if jsonServer.Status.LastResetTime != nil {
+		last = jsonServer.Status.LastResetTime.Time
+	}
+	return schedule.Next(last)
+}
+
+// resetToken identifies the last reset, it is empty when the data was never reset
+func resetToken(jsonServer *examplecomv1.JsonServer) string {
+	if jsonServer.Status.LastResetTime == nil {
+		return ""
+	}
+	return jsonServer.Status.LastResetTime.UTC().Format(time.RFC3339)
+}
+
+// now returns the current time of the reconciler clock
+func (r *JsonServerReconciler) now() time.Time {
+	if r.Clock != nil {
+		return r.Clock.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+// maxResourceSummaries limits the number of resources reported in status
+const maxResourceSummaries = 100
+
+// summarizeResources returns the top-level arrays and objects of jsonConfig
+// in document order. Scalar values are not served as routes and are skipped.
+func summarizeResources(jsonConfig string) []examplecomv1.ResourceSummary {
+	dec := json.NewDecoder(strings.NewReader(jsonConfig))
+
+	// The document must be an object to have resources
+	tok, err := dec.Token()
+	if err != nil || tok != json.Delim('{') {
+		return nil
+	}
+
+	var summaries []examplecomv1.ResourceSummary
+	for dec.More() && len(summaries) < maxResourceSummaries {
+		tok, err := dec.Token()
+		if err != nil {
+			return summaries
+		}
+		name, _ := tok.(string)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return summaries
+		}
+
+		switch {
+		case bytes.HasPrefix(value, []byte("[")):
+			var items []json.RawMessage
+			if err := json.Unmarshal(value, &items); err == nil {
+				summaries = append(summaries, examplecomv1.ResourceSummary{Name: name, Kind: examplecomv1.ResourceKindArray, Count: int32(len(items))})
+			}
+		case bytes.HasPrefix(value, []byte("{")):
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(value, &fields); err == nil {
+				summaries = append(summaries, examplecomv1.ResourceSummary{Name: name, Kind: examplecomv1.ResourceKindObject, Count: int32(len(fields))})
+			}
+		}
+	}
+
+	return summaries
+}
+
+// internalURL returns the in-cluster URL of the json-server Service
+func internalURL(jsonServer *examplecomv1.JsonServer) string {
+	return fmt.Sprintf("http://%s.%s.svc:%d", jsonServer.Name, jsonServer.Namespace, servicePort(jsonServer))
+}
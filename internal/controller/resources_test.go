@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"testing"
+
+	examplev1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+func TestSummarizeResources(t *testing.T) {
+	summaries := summarizeResources(`{"posts": [{"id": 1}, {"id": 2}], "profile": {"name": "a"}, "version": 3, "comments": []}`)
+
+	want := []examplev1.ResourceSummary{
+		{Name: "posts", Kind: examplev1.ResourceKindArray, Count: 2},
+		{Name: "profile", Kind: examplev1.ResourceKindObject, Count: 1},
+		{Name: "comments", Kind: examplev1.ResourceKindArray, Count: 0},
+	}
+	if len(summaries) != len(want) {
+		t.Fatalf("expected %d resources, got %+v", len(want), summaries)
+	}
+	for i := range want {
+		if summaries[i] != want[i] {
+			t.Errorf("resource %d: expected %+v, got %+v", i, want[i], summaries[i])
+		}
+	}
+
+	if summaries := summarizeResources(`[1, 2]`); summaries != nil {
+		t.Errorf("expected no resources for a top-level array, got %+v", summaries)
+	}
+}
@@ -0,0 +1,369 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+const (
+	// configRevisionLabel is set to the revision hash on every ConfigMap of a data revision
+	configRevisionLabel = "example.com/config-revision"
+
+	// revisionAnnotation holds the sequence number of a revision on its main ConfigMap
+	revisionAnnotation = "example.com/revision"
+
+	// configCurrentLabel marks the mutable ConfigMap holding a copy of the
+	// served revision for the InPlace reload strategy
+	configCurrentLabel = "example.com/config-current"
+
+	// defaultRevisionHistoryLimit is used when spec.revisionHistoryLimit is not set
+	defaultRevisionHistoryLimit int32 = 10
+)
+
+// errRevisionNotFound is returned when spec.rollbackTo names an unknown revision
+type errRevisionNotFound struct {
+	hash string
+}
+
+func (e *errRevisionNotFound) Error() string {
+	return fmt.Sprintf("revision %s not found", e.hash)
+}
+
+// revisionConfigMapName returns the name of the main ConfigMap of a revision
+func revisionConfigMapName(jsonServer *examplecomv1.JsonServer, hash string) string {
+	return fmt.Sprintf("%s-config-%s", jsonServer.Name, hash)
+}
+
+// currentConfigMapName returns the name of the mutable ConfigMap mounted with the InPlace reload strategy
+func currentConfigMapName(jsonServer *examplecomv1.JsonServer) string {
+	return fmt.Sprintf("%s-config", jsonServer.Name)
+}
+
+// shardConfigMapName returns the name of the ConfigMap holding the i-th chunk (i >= 1) of a revision
+func shardConfigMapName(jsonServer *examplecomv1.JsonServer, hash string, i int) string {
+	return fmt.Sprintf("%s-config-%s-%d", jsonServer.Name, hash, i)
+}
+
+// revisionNumber returns the sequence number of a revision ConfigMap
+func revisionNumber(configMap *corev1.ConfigMap) int64 {
+	n, _ := strconv.ParseInt(configMap.Annotations[revisionAnnotation], 10, 64)
+	return n
+}
+
+// isShard reports whether the ConfigMap holds a further chunk of a revision
+func isShard(configMap *corev1.ConfigMap) bool {
+	_, ok := configMap.Labels[configShardLabel]
+	return ok
+}
+
+// listConfigMaps returns the data ConfigMaps controlled by the JsonServer
+func (r *JsonServerReconciler) listConfigMaps(ctx context.Context, jsonServer *examplecomv1.JsonServer) ([]corev1.ConfigMap, error) {
+	list := &corev1.ConfigMapList{}
+	if err := r.List(ctx, list, client.InNamespace(jsonServer.Namespace), client.MatchingLabels{"app": jsonServer.Name}); err != nil {
+		return nil, err
+	}
+
+	configMaps := make([]corev1.ConfigMap, 0, len(list.Items))
+	for _, configMap := range list.Items {
+		if metav1.IsControlledBy(&configMap, jsonServer) {
+			configMaps = append(configMaps, configMap)
+		}
+	}
+	return configMaps, nil
+}
+
+// revisionLabels returns the labels of the ConfigMaps of a revision
+func revisionLabels(jsonServer *examplecomv1.JsonServer, hash string) map[string]string {
+	return map[string]string{
+		"app":                          jsonServer.Name,
+		"app.kubernetes.io/name":       jsonServer.Name,
+		"app.kubernetes.io/managed-by": "json-server-controller",
+		configRevisionLabel:            hash,
+	}
+}
+
+// createImmutable creates the ConfigMap unless it exists. The data of a
+// revision is addressed by its hash and never changes once written.
+func (r *JsonServerReconciler) createImmutable(ctx context.Context, jsonServer *examplecomv1.JsonServer, configMap *corev1.ConfigMap) (controllerutil.OperationResult, error) {
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(configMap), existing)
+	if err == nil {
+		*configMap = *existing
+		return controllerutil.OperationResultNone, nil
+	}
+	if !errors.IsNotFound(err) {
+		return controllerutil.OperationResultNone, err
+	}
+
+	// Set the owner reference
+	if err := controllerutil.SetControllerReference(jsonServer, configMap, r.Scheme); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	configMap.Immutable = ptr.To(true)
+
+	if err := r.Create(ctx, configMap); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return controllerutil.OperationResultCreated, nil
+}
+
+// reconcileShards creates the ConfigMaps holding the chunks after the first one
+// and returns their names in chunk order
+func (r *JsonServerReconciler) reconcileShards(ctx context.Context, jsonServer *examplecomv1.JsonServer, hash string, payload *configPayload) ([]string, error) {
+	var names []string
+	for i := 1; i < len(payload.chunks); i++ {
+		labels := revisionLabels(jsonServer, hash)
+		labels[configShardLabel] = strconv.Itoa(i)
+
+		shard := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      shardConfigMapName(jsonServer, hash, i),
+				Namespace: jsonServer.Namespace,
+				Labels:    labels,
+			},
+			BinaryData: map[string][]byte{
+				chunkKey(i): payload.chunks[i],
+			},
+		}
+
+		op, err := r.createImmutable(ctx, jsonServer, shard)
+		if err != nil {
+			return nil, err
+		}
+
+		log.FromContext(ctx).Info("ConfigMap shard operation completed", "operation", op, "ConfigMap.Name", shard.Name)
+		names = append(names, shard.Name)
+	}
+	return names, nil
+}
+
+// loadRevision returns the layout and db.json content of an existing revision
+func (r *JsonServerReconciler) loadRevision(ctx context.Context, jsonServer *examplecomv1.JsonServer, hash string) (*dataLayout, string, error) {
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: revisionConfigMapName(jsonServer, hash), Namespace: jsonServer.Namespace}, configMap)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, "", &errRevisionNotFound{hash: hash}
+		}
+		return nil, "", err
+	}
+	if !metav1.IsControlledBy(configMap, jsonServer) {
+		return nil, "", &errRevisionNotFound{hash: hash}
+	}
+
+	layout := &dataLayout{
+		configHash: hash,
+		configMaps: []string{configMap.Name},
+		files:      configMap.Data,
+	}
+	_, layout.routes = configMap.Data["routes.json"]
+	if len(configMap.BinaryData) == 0 {
+		return layout, configMap.Data["db.json"], nil
+	}
+
+	// Collect the shards of a compressed revision in chunk order
+	layout.compressed = true
+	chunks := [][]byte{configMap.BinaryData[chunkKey(0)]}
+	for i := 1; ; i++ {
+		shard := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{Name: shardConfigMapName(jsonServer, hash, i), Namespace: jsonServer.Namespace}, shard)
+		if errors.IsNotFound(err) {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		layout.configMaps = append(layout.configMaps, shard.Name)
+		chunks = append(chunks, shard.BinaryData[chunkKey(i)])
+	}
+
+	jsonConfig, err := decompressChunks(chunks)
+	if err != nil {
+		return nil, "", fmt.Errorf("revision %s: %w", hash, err)
+	}
+	return layout, jsonConfig, nil
+}
+
+// reconcileCurrentConfigMap copies the files of the served revision into the
+// mutable ConfigMap mounted with the InPlace reload strategy. The pod template
+// then stays the same across data changes, the kubelet refreshes the mounted
+// files and json-server --watch reloads them. Compressed data and persistent
+// volumes are seeded by an init container and keep mounting the revision.
+func (r *JsonServerReconciler) reconcileCurrentConfigMap(ctx context.Context, jsonServer *examplecomv1.JsonServer, layout *dataLayout) error {
+	if jsonServer.Spec.ReloadStrategy != examplecomv1.ReloadStrategyInPlace || usesDataVolume(jsonServer, layout) {
+		return nil
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      currentConfigMapName(jsonServer),
+			Namespace: jsonServer.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, configMap, func() error {
+		// Set the owner reference
+		if err := controllerutil.SetControllerReference(jsonServer, configMap, r.Scheme); err != nil {
+			return err
+		}
+
+		labels := revisionLabels(jsonServer, layout.configHash)
+		delete(labels, configRevisionLabel)
+		labels[configCurrentLabel] = "true"
+		configMap.Labels = labels
+		configMap.Annotations = map[string]string{
+			configHashAnnotation: layout.configHash,
+		}
+		configMap.Data = layout.files
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Current ConfigMap operation completed", "operation", op)
+	r.recordOperation(jsonServer, "ConfigMap", configMap.Name, op)
+	layout.current = configMap.Name
+	return nil
+}
+
+// rolloutConfigMaps returns the ConfigMaps mounted by the pods of every
+// ReplicaSet of the Deployment while it is still rolling out, so that the
+// revision of the old pods is not pruned before they are replaced
+func (r *JsonServerReconciler) rolloutConfigMaps(ctx context.Context, jsonServer *examplecomv1.JsonServer, deployment *appsv1.Deployment) ([]string, error) {
+	if deployment.Status.ObservedGeneration >= deployment.Generation && deployment.Status.UpdatedReplicas == deployment.Status.Replicas {
+		return nil, nil
+	}
+
+	list := &appsv1.ReplicaSetList{}
+	if err := apiReader(r.Client, r.APIReader).List(ctx, list, client.InNamespace(jsonServer.Namespace), client.MatchingLabels{"app": jsonServer.Name}); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i := range list.Items {
+		replicaSet := &list.Items[i]
+		if !metav1.IsControlledBy(replicaSet, deployment) || replicaSet.Status.Replicas == 0 {
+			continue
+		}
+		for _, volume := range replicaSet.Spec.Template.Spec.Volumes {
+			switch {
+			case volume.ConfigMap != nil:
+				names = append(names, volume.ConfigMap.Name)
+			case volume.Projected != nil:
+				for _, source := range volume.Projected.Sources {
+					if source.ConfigMap != nil {
+						names = append(names, source.ConfigMap.Name)
+					}
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
+// pruneRevisions deletes the ConfigMaps of revisions beyond
+// spec.revisionHistoryLimit, never touching the revisions in keep or the
+// revisions of the mounted ConfigMaps, and returns the remaining revisions
+// newest first. The mutable ConfigMap of the InPlace reload strategy is kept
+// while current names it.
+func (r *JsonServerReconciler) pruneRevisions(ctx context.Context, jsonServer *examplecomv1.JsonServer, current string, mounted []string, keep ...string) ([]examplecomv1.ConfigRevision, error) {
+	configMaps, err := r.listConfigMaps(ctx, jsonServer)
+	if err != nil {
+		return nil, err
+	}
+	for i := range configMaps {
+		if hash, ok := configMaps[i].Labels[configRevisionLabel]; ok && slices.Contains(mounted, configMaps[i].Name) {
+			keep = append(keep, hash)
+		}
+	}
+
+	var revisions []examplecomv1.ConfigRevision
+	for i := range configMaps {
+		configMap := &configMaps[i]
+		if hash, ok := configMap.Labels[configRevisionLabel]; ok && !isShard(configMap) {
+			revisions = append(revisions, examplecomv1.ConfigRevision{
+				Revision:      revisionNumber(configMap),
+				Hash:          hash,
+				ConfigMapName: configMap.Name,
+			})
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		if revisions[i].Revision != revisions[j].Revision {
+			return revisions[i].Revision > revisions[j].Revision
+		}
+		return revisions[i].Hash < revisions[j].Hash
+	})
+
+	limit := defaultRevisionHistoryLimit
+	if jsonServer.Spec.RevisionHistoryLimit != nil {
+		limit = *jsonServer.Spec.RevisionHistoryLimit
+	}
+
+	kept := map[string]bool{}
+	for _, hash := range keep {
+		kept[hash] = true
+	}
+	var old int32
+	result := make([]examplecomv1.ConfigRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		if !kept[revision.Hash] {
+			if old >= limit {
+				continue
+			}
+			old++
+			kept[revision.Hash] = true
+		}
+		result = append(result, revision)
+	}
+
+	// Delete pruned revisions together with their shards. ConfigMaps without
+	// a revision label were written by earlier controller versions.
+	for i := range configMaps {
+		configMap := &configMaps[i]
+		if kept[configMap.Labels[configRevisionLabel]] || (current != "" && configMap.Name == current) {
+			continue
+		}
+		if err := r.Delete(ctx, configMap); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		log.FromContext(ctx).Info("ConfigMap revision pruned", "ConfigMap.Name", configMap.Name)
+		r.recordDeletion(jsonServer, configMap)
+	}
+
+	return result, nil
+}
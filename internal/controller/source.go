@@ -0,0 +1,213 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	examplecomv1 "github.com/yourusername/json-server-controller/api/v1"
+)
+
+const (
+	// configMapSourceIndex indexes JsonServers by spec.source.configMapKeyRef.name
+	configMapSourceIndex = "spec.source.configMapKeyRef.name"
+
+	// secretSourceIndex indexes JsonServers by spec.source.secretKeyRef.name
+	secretSourceIndex = "spec.source.secretKeyRef.name"
+
+	// restoreFromIndex indexes JsonServers by spec.restoreFrom.snapshotName
+	restoreFromIndex = "spec.restoreFrom.snapshotName"
+)
+
+// errSourceKeyNotFound is returned when the referenced object lacks the selected key
+type errSourceKeyNotFound struct {
+	kind, name, key string
+}
+
+func (e *errSourceKeyNotFound) Error() string {
+	return fmt.Sprintf("key %q not found in %s %s", e.key, e.kind, e.name)
+}
+
+// errSnapshotNotReady is returned when the referenced snapshot has not completed
+type errSnapshotNotReady struct {
+	name, phase string
+}
+
+func (e *errSnapshotNotReady) Error() string {
+	return fmt.Sprintf("JsonServerSnapshot %s is not completed (phase %q)", e.name, e.phase)
+}
+
+// apiReader returns the reader for objects that are not watched, like Secrets
+// of which only the metadata is watched. They are read from the API server
+// instead of the cache when possible.
+func apiReader(c client.Client, apiReader client.Reader) client.Reader {
+	if apiReader != nil {
+		return apiReader
+	}
+	return c
+}
+
+// hasSourceRef reports whether the JsonServer loads its data from spec.source
+func hasSourceRef(jsonServer *examplecomv1.JsonServer) bool {
+	src := jsonServer.Spec.Source
+	return src != nil && (src.ConfigMapKeyRef != nil || src.SecretKeyRef != nil)
+}
+
+// resolveJsonConfig returns the db.json content of the JsonServer, reading the
+// referenced ConfigMap or Secret when spec.source is set
+func (r *JsonServerReconciler) resolveJsonConfig(ctx context.Context, jsonServer *examplecomv1.JsonServer) (string, error) {
+	src := jsonServer.Spec.Source
+	switch {
+	case src != nil && src.ConfigMapKeyRef != nil:
+		ref := src.ConfigMapKeyRef
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: jsonServer.Namespace}, cm); err != nil {
+			return "", err
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			return data, nil
+		}
+		if data, ok := cm.BinaryData[ref.Key]; ok {
+			return string(data), nil
+		}
+		return "", &errSourceKeyNotFound{kind: "ConfigMap", name: ref.Name, key: ref.Key}
+
+	case src != nil && src.SecretKeyRef != nil:
+		ref := src.SecretKeyRef
+		secret := &corev1.Secret{}
+		if err := apiReader(r.Client, r.APIReader).Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: jsonServer.Namespace}, secret); err != nil {
+			return "", err
+		}
+		if data, ok := secret.Data[ref.Key]; ok {
+			return string(data), nil
+		}
+		return "", &errSourceKeyNotFound{kind: "Secret", name: ref.Name, key: ref.Key}
+
+	case jsonServer.Spec.RestoreFrom != nil:
+		name := jsonServer.Spec.RestoreFrom.SnapshotName
+		snapshot := &examplecomv1.JsonServerSnapshot{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: jsonServer.Namespace}, snapshot); err != nil {
+			return "", err
+		}
+		if snapshot.Status.Phase != examplecomv1.SnapshotPhaseCompleted {
+			return "", &errSnapshotNotReady{name: name, phase: snapshot.Status.Phase}
+		}
+		return readSnapshotData(ctx, r.Client, apiReader(r.Client, r.APIReader), snapshot)
+	}
+
+	return jsonServer.Spec.JsonConfig, nil
+}
+
+// sourceField returns the spec field the data of the JsonServer comes from, for status messages
+func sourceField(jsonServer *examplecomv1.JsonServer) string {
+	switch {
+	case hasSourceRef(jsonServer):
+		return "spec.source"
+	case jsonServer.Spec.RestoreFrom != nil:
+		return "spec.restoreFrom"
+	}
+	return "spec.jsonConfig"
+}
+
+// sourceVolumeProjection returns the projection mounting the referenced key as
+// db.json, or nil when the data is inline
+func sourceVolumeProjection(jsonServer *examplecomv1.JsonServer) *corev1.VolumeProjection {
+	src := jsonServer.Spec.Source
+	switch {
+	case src != nil && src.ConfigMapKeyRef != nil:
+		return &corev1.VolumeProjection{
+			ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: src.ConfigMapKeyRef.LocalObjectReference,
+				Items:                []corev1.KeyToPath{{Key: src.ConfigMapKeyRef.Key, Path: "db.json"}},
+			},
+		}
+	case src != nil && src.SecretKeyRef != nil:
+		return &corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: src.SecretKeyRef.LocalObjectReference,
+				Items:                []corev1.KeyToPath{{Key: src.SecretKeyRef.Key, Path: "db.json"}},
+			},
+		}
+	}
+	return nil
+}
+
+// indexConfigMapSource is the field indexer for configMapSourceIndex
+func indexConfigMapSource(obj client.Object) []string {
+	jsonServer := obj.(*examplecomv1.JsonServer)
+	if jsonServer.Spec.Source == nil || jsonServer.Spec.Source.ConfigMapKeyRef == nil {
+		return nil
+	}
+	return []string{jsonServer.Spec.Source.ConfigMapKeyRef.Name}
+}
+
+// indexSecretSource is the field indexer for secretSourceIndex
+func indexSecretSource(obj client.Object) []string {
+	jsonServer := obj.(*examplecomv1.JsonServer)
+	if jsonServer.Spec.Source == nil || jsonServer.Spec.Source.SecretKeyRef == nil {
+		return nil
+	}
+	return []string{jsonServer.Spec.Source.SecretKeyRef.Name}
+}
+
+// indexRestoreFrom is the field indexer for restoreFromIndex
+func indexRestoreFrom(obj client.Object) []string {
+	jsonServer := obj.(*examplecomv1.JsonServer)
+	if jsonServer.Spec.RestoreFrom == nil {
+		return nil
+	}
+	return []string{jsonServer.Spec.RestoreFrom.SnapshotName}
+}
+
+// jsonServersForConfigMap maps a ConfigMap to the JsonServers referencing it
+func (r *JsonServerReconciler) jsonServersForConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.jsonServersForIndex(ctx, configMapSourceIndex, obj)
+}
+
+// jsonServersForSecret maps a Secret to the JsonServers referencing it
+func (r *JsonServerReconciler) jsonServersForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.jsonServersForIndex(ctx, secretSourceIndex, obj)
+}
+
+// jsonServersForSnapshot maps a JsonServerSnapshot to the JsonServers restoring from it
+func (r *JsonServerReconciler) jsonServersForSnapshot(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.jsonServersForIndex(ctx, restoreFromIndex, obj)
+}
+
+// jsonServersForIndex lists the JsonServers in the namespace of obj whose index matches its name
+func (r *JsonServerReconciler) jsonServersForIndex(ctx context.Context, index string, obj client.Object) []reconcile.Request {
+	jsonServers := &examplecomv1.JsonServerList{}
+	if err := r.List(ctx, jsonServers, client.InNamespace(obj.GetNamespace()), client.MatchingFields{index: obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list JsonServers for source", "index", index, "name", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(jsonServers.Items))
+	for _, item := range jsonServers.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: item.Name, Namespace: item.Namespace},
+		})
+	}
+	return requests
+}
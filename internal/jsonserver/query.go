@@ -0,0 +1,386 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reservedParams are the query parameters that are not field filters
+var reservedParams = map[string]bool{
+	"_page": true, "_limit": true, "_sort": true, "_order": true,
+	"_start": true, "_end": true, "_embed": true, "_expand": true, "q": true,
+}
+
+// filterOperators are the suffixes of filter parameters, e.g. views_gte=10
+var filterOperators = []string{"_gte", "_lte", "_ne", "_like"}
+
+// list writes the items of a collection after filtering, full-text search,
+// sorting, pagination and embedding, in the order json-server applies them
+func (s *Server) list(w http.ResponseWriter, req *http.Request, name string, items []interface{}) {
+	query := req.URL.Query()
+
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if matches(item, query) {
+			result = append(result, item)
+		}
+	}
+
+	if keys := query.Get("_sort"); keys != "" {
+		sortItems(result, splitValues(query["_sort"]), splitValues(query["_order"]))
+	}
+
+	total := len(result)
+	switch {
+	case query.Has("_page"):
+		page := atoi(query.Get("_page"), 1)
+		limit := atoi(query.Get("_limit"), 10)
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 10
+		}
+		// Compare pages before multiplying, so that huge values cannot overflow
+		last := 1
+		if total > 0 {
+			last = (total-1)/limit + 1
+		}
+		start := total
+		if page <= last {
+			start = (page - 1) * limit
+		}
+		result = result[start : start+min(limit, total-start)]
+
+		links := []string{pageLink(req, 1, limit, "first")}
+		if page > 1 {
+			links = append(links, pageLink(req, page-1, limit, "prev"))
+		}
+		if page < last {
+			links = append(links, pageLink(req, page+1, limit, "next"))
+		}
+		links = append(links, pageLink(req, last, limit, "last"))
+		w.Header().Set("Link", strings.Join(links, ", "))
+	case query.Has("_end"):
+		start := clamp(atoi(query.Get("_start"), 0), total)
+		end := clamp(atoi(query.Get("_end"), total), total)
+		result = result[start:max(start, end)]
+	case query.Has("_limit"):
+		start := clamp(atoi(query.Get("_start"), 0), total)
+		result = result[start : start+clamp(atoi(query.Get("_limit"), total), total-start)]
+	}
+	if query.Has("_page") || query.Has("_end") || query.Has("_limit") {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, Link")
+	}
+
+	embeds, expands := query["_embed"], query["_expand"]
+	for i, item := range result {
+		if object, ok := item.(map[string]interface{}); ok {
+			result[i] = s.withRelations(object, name, embeds, expands)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// withRelations returns a copy of the item with the children named in
+// _embed, e.g. the comments with postId of a post, and the parents named in
+// _expand, e.g. the post of a comment
+func (s *Server) withRelations(item map[string]interface{}, name string, embeds, expands []string) map[string]interface{} {
+	if len(embeds) == 0 && len(expands) == 0 {
+		return item
+	}
+
+	out := merge(item, nil)
+	id := idString(item["id"])
+	for _, child := range splitValues(embeds) {
+		items, ok := s.db[child].([]interface{})
+		if !ok {
+			continue
+		}
+		foreignKey := singular(name) + "Id"
+		children := []interface{}{}
+		for _, c := range items {
+			if object, ok := c.(map[string]interface{}); ok && equal(object[foreignKey], id) {
+				children = append(children, c)
+			}
+		}
+		out[child] = children
+	}
+	for _, parent := range splitValues(expands) {
+		items, ok := s.db[plural(parent)].([]interface{})
+		parentID, set := item[parent+"Id"]
+		if !ok || !set {
+			continue
+		}
+		if i := findByID(items, idString(parentID)); i >= 0 {
+			out[parent] = items[i]
+		}
+	}
+	return out
+}
+
+// matches reports whether the item passes the full-text search and every
+// field filter of the query
+func matches(item interface{}, query url.Values) bool {
+	if q := query.Get("q"); q != "" && !containsText(item, strings.ToLower(q)) {
+		return false
+	}
+
+	for key, values := range query {
+		if reservedParams[key] {
+			continue
+		}
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		field, operator := key, ""
+		for _, suffix := range filterOperators {
+			if strings.HasSuffix(key, suffix) {
+				field, operator = strings.TrimSuffix(key, suffix), suffix
+				break
+			}
+		}
+		value, found := lookup(object, field)
+
+		switch operator {
+		case "":
+			// Repeated parameters match any of the values
+			if !found || !anyValue(values, func(v string) bool { return equal(value, v) }) {
+				return false
+			}
+		case "_ne":
+			if anyValue(values, func(v string) bool { return found && equal(value, v) }) {
+				return false
+			}
+		case "_gte":
+			if !found || anyValue(values, func(v string) bool { return compare(value, v) < 0 }) {
+				return false
+			}
+		case "_lte":
+			if !found || anyValue(values, func(v string) bool { return compare(value, v) > 0 }) {
+				return false
+			}
+		case "_like":
+			if !found || !anyValue(values, func(v string) bool {
+				re, err := regexp.Compile("(?i)" + v)
+				return err == nil && re.MatchString(idString(value))
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sortItems sorts by the _sort fields, each ascending unless the matching
+// _order is desc
+func sortItems(items []interface{}, fields, orders []string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, _ := items[i].(map[string]interface{})
+		b, _ := items[j].(map[string]interface{})
+		for k, field := range fields {
+			va, _ := lookup(a, field)
+			vb, _ := lookup(b, field)
+			c := compareValues(va, vb)
+			if c == 0 {
+				continue
+			}
+			if k < len(orders) && strings.EqualFold(orders[k], "desc") {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// lookup returns the value at a dotted path such as author.name
+func lookup(object map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = object
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// containsText reports whether any string in the value contains the lowercase text
+func containsText(value interface{}, text string) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(strings.ToLower(v), text)
+	case map[string]interface{}:
+		for _, child := range v {
+			if containsText(child, text) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if containsText(child, text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equal compares a JSON value with a query or path value. Like json-server,
+// the number 1 and the string "1" are the same id.
+func equal(value interface{}, s string) bool {
+	return idString(value) == s
+}
+
+// compare orders a JSON value against a query value, numerically when both are numbers
+func compare(value interface{}, s string) int {
+	return compareValues(value, json.Number(s))
+}
+
+// compareValues orders two JSON values, numerically when both are numbers
+func compareValues(a, b interface{}) int {
+	if fa, ok := number(a); ok {
+		if fb, ok := number(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(idString(a), idString(b))
+}
+
+// number returns the value as a float when it is a JSON number
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// idString returns the text form of a JSON value used to compare ids and filters
+func idString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// singular returns the singular of a collection name, e.g. posts -> post,
+// used for foreign keys like postId
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// plural returns the collection name of a singular, e.g. post -> posts
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return strings.TrimSuffix(name, "y") + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
+
+// pageLink returns a Link header entry for a page of the current request
+func pageLink(req *http.Request, page, limit int, rel string) string {
+	query := req.URL.Query()
+	query.Set("_page", strconv.Itoa(page))
+	query.Set("_limit", strconv.Itoa(limit))
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: req.Host, Path: req.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+}
+
+// splitValues splits repeated and comma-separated query values
+func splitValues(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// anyValue reports whether f holds for one of the values
+func anyValue(values []string, f func(string) bool) bool {
+	for _, v := range values {
+		if f(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// atoi parses a query value, returning def when it is not a number
+func atoi(s string, def int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return def
+}
+
+// clamp limits i to [0, n]
+func clamp(i, n int) int {
+	return max(0, min(i, n))
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	// routeTokenPattern matches the escaped characters, wildcards and :name
+	// parameters of a rule
+	routeTokenPattern = regexp.MustCompile(`\\(.)|\*|:(\w+)`)
+
+	// routeTargetPattern matches the $1 and :name references of a target
+	routeTargetPattern = regexp.MustCompile(`\$(\d+)|:(\w+)`)
+)
+
+// rewriteRule is a compiled routes.json entry
+type rewriteRule struct {
+	pattern *regexp.Regexp
+	params  map[string]int
+	target  string
+}
+
+// Rewriter applies json-server routes.json rules such as "/api/*": "/$1" to
+// request URLs. Rules are applied one after another in the order of their
+// keys, each to the result of the previous ones.
+type Rewriter struct {
+	rules []rewriteRule
+}
+
+// NewRewriter compiles rewrite rules. In a rule "*" matches anything, ":name"
+// one path segment and a backslash escapes the next character, e.g. \?; the
+// target refers to the matches as $1, $2, ... or :name.
+func NewRewriter(routes map[string]string) (*Rewriter, error) {
+	keys := make([]string, 0, len(routes))
+	for from := range routes {
+		keys = append(keys, from)
+	}
+	sort.Strings(keys)
+
+	r := &Rewriter{}
+	for _, from := range keys {
+		rule := rewriteRule{params: map[string]int{}, target: routes[from]}
+		expr, last, group := "(?i)^", 0, 0
+		for _, m := range routeTokenPattern.FindAllStringSubmatchIndex(from, -1) {
+			expr += regexp.QuoteMeta(from[last:m[0]])
+			last = m[1]
+			switch {
+			case m[2] >= 0:
+				expr += regexp.QuoteMeta(from[m[2]:m[3]])
+				continue
+			case m[4] >= 0:
+				group++
+				expr += "([^/]+?)"
+				rule.params[from[m[4]:m[5]]] = group
+			default:
+				group++
+				expr += "(.*)"
+			}
+		}
+		expr += regexp.QuoteMeta(from[last:]) + `/?$`
+
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q: %w", from, err)
+		}
+		rule.pattern = pattern
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// LoadRoutes reads a routes.json file
+func LoadRoutes(path string) (*Rewriter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var routes map[string]string
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("invalid routes in %s: %w", path, err)
+	}
+	return NewRewriter(routes)
+}
+
+// Rewrite returns the URL after applying the rules. Like json-server, rules
+// match the path together with the query string.
+func (r *Rewriter) Rewrite(u *url.URL) *url.URL {
+	current := u.RequestURI()
+	for _, rule := range r.rules {
+		m := rule.pattern.FindStringSubmatch(current)
+		if m == nil {
+			continue
+		}
+		current = routeTargetPattern.ReplaceAllStringFunc(rule.target, func(ref string) string {
+			sub := routeTargetPattern.FindStringSubmatch(ref)
+			if sub[2] != "" {
+				if i, ok := rule.params[sub[2]]; ok {
+					return m[i]
+				}
+				return ref
+			}
+			if i, _ := strconv.Atoi(sub[1]); i > 0 && i < len(m) {
+				return m[i]
+			}
+			return ""
+		})
+	}
+
+	rewritten, err := url.ParseRequestURI(current)
+	if err != nil {
+		return u
+	}
+	return rewritten
+}
+
+// rewrite updates the request URL with the rules of the rewriter, if any
+func (r *Rewriter) rewrite(req *http.Request) {
+	if r == nil || len(r.rules) == 0 {
+		return
+	}
+	rewritten := r.Rewrite(req.URL)
+	req.URL.Path, req.URL.RawPath, req.URL.RawQuery = rewritten.Path, rewritten.RawPath, rewritten.RawQuery
+}
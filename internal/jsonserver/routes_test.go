@@ -0,0 +1,48 @@
+package jsonserver
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRewriter_Rewrite(t *testing.T) {
+	r, err := NewRewriter(map[string]string{
+		"/api/v2/*":                "/$1",
+		"/blog/:resource/:id/show": "/:resource/:id",
+		"/articles\\?id=:id":       "/posts/:id",
+	})
+	if err != nil {
+		t.Fatalf("failed to compile routes: %v", err)
+	}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/api/v2/posts?_sort=views", "/posts?_sort=views"},
+		{"/API/V2/posts/1/", "/posts/1/"},
+		{"/blog/posts/1/show", "/posts/1"},
+		{"/articles?id=2", "/posts/2"},
+		{"/posts", "/posts"},
+	}
+	for _, tt := range tests {
+		u, _ := url.ParseRequestURI(tt.target)
+		if got := r.Rewrite(u).RequestURI(); got != tt.want {
+			t.Errorf("rewrite %s: expected %s, got %s", tt.target, tt.want, got)
+		}
+	}
+}
+
+func TestServer_Routes(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Rewriter, _ = NewRewriter(map[string]string{"/api/v2/*": "/$1"})
+
+	rec, v := do(t, s, http.MethodGet, "/api/v2/posts?views_gte=50", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got := ids(v); !equalIDs(got, []float64{1, 3}) {
+		t.Errorf("expected the rewritten query to apply, got %v", got)
+	}
+}
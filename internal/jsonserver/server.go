@@ -0,0 +1,490 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jsonserver implements the REST API of json-server over a db.json
+// file. It backs JsonServers with spec.runtime go.
+package jsonserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Server serves the collections and singular resources of a db.json file.
+// Changes made through the API are written back to the file; when the file
+// cannot be written, e.g. on a read-only ConfigMap mount, they are only kept
+// in memory.
+type Server struct {
+	// Log receives load and save errors
+	Log logr.Logger
+
+	// Rewriter applies routes.json rules before routing, when set
+	Rewriter *Rewriter
+
+	path string
+
+	mu         sync.RWMutex
+	db         map[string]interface{}
+	modTime    time.Time
+	saveFailed bool
+}
+
+// Load reads the db.json file at path
+func Load(path string) (*Server, error) {
+	s := &Server{path: path, Log: logr.Discard()}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload replaces the data with the content of the file
+func (s *Server) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	db, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the file whenever it changes until ctx is done. Changes are
+// detected by polling, which also catches the symlink swap of an updated
+// ConfigMap volume.
+func (s *Server) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil {
+			continue
+		}
+		s.mu.RLock()
+		changed := !info.ModTime().Equal(s.modTime)
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := s.reload(); err != nil {
+			s.Log.Error(err, "Failed to reload data, keeping the previous data")
+			continue
+		}
+		s.Log.Info("Data reloaded", "path", s.path)
+	}
+}
+
+// save writes the data back to the file. It must be called with mu held.
+func (s *Server) save() {
+	data, err := json.MarshalIndent(s.db, "", "  ")
+	if err == nil {
+		// Replace the file atomically so that a crash never leaves partial data
+		tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		if !s.saveFailed {
+			s.Log.Error(err, "Failed to save data, changes are kept in memory only", "path", s.path)
+			s.saveFailed = true
+		}
+		return
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+}
+
+// decode parses db.json, keeping numbers as json.Number so that ids and
+// values are served unchanged
+func decode(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var db map[string]interface{}
+	if err := dec.Decode(&db); err != nil {
+		return nil, fmt.Errorf("db.json must contain a JSON object: %w", err)
+	}
+	if db == nil {
+		db = map[string]interface{}{}
+	}
+	return db, nil
+}
+
+// ServeHTTP implements the json-server routes:
+//
+//	GET    /db
+//	GET    /{collection}, /{collection}/{id}
+//	POST   /{collection}
+//	PUT    /{collection}/{id}, PATCH /{collection}/{id}, DELETE /{collection}/{id}
+//	GET    /{parent}/{id}/{collection}, POST /{parent}/{id}/{collection}
+//	GET    /{singular}, PUT /{singular}, PATCH /{singular}, POST /{singular}
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// json-server allows cross-origin requests from any origin
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		origin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	if req.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,PUT,PATCH,POST,DELETE")
+		if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s.Rewriter.rewrite(req)
+
+	method := req.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	path := strings.Trim(req.URL.Path, "/")
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(parts) == 0 && method == http.MethodGet:
+		s.serveIndex(w)
+	case len(parts) == 1 && parts[0] == "db" && method == http.MethodGet:
+		s.serveDB(w)
+	case len(parts) == 1:
+		s.serveResource(w, req, method, parts[0])
+	case len(parts) == 2:
+		s.serveItem(w, req, method, parts[0], parts[1])
+	case len(parts) == 3:
+		s.serveNested(w, req, method, parts[0], parts[1], parts[2])
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{})
+	}
+}
+
+// serveIndex lists the resources of the database
+func (s *Server) serveIndex(w http.ResponseWriter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resources := map[string]string{}
+	for name := range s.db {
+		resources[name] = "/" + name
+	}
+	writeJSON(w, http.StatusOK, resources)
+}
+
+// serveDB returns the whole database
+func (s *Server) serveDB(w http.ResponseWriter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, s.db)
+}
+
+// serveResource handles a collection or a singular resource
+func (s *Server) serveResource(w http.ResponseWriter, req *http.Request, method, name string) {
+	if method == http.MethodGet {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	} else {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	switch value := s.db[name].(type) {
+	case []interface{}:
+		switch method {
+		case http.MethodGet:
+			s.list(w, req, name, value)
+		case http.MethodPost:
+			s.create(w, req, name, nil)
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{})
+		}
+	case map[string]interface{}:
+		switch method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, value)
+		case http.MethodPut, http.MethodPost, http.MethodPatch:
+			body, ok := readObject(w, req)
+			if !ok {
+				return
+			}
+			if method == http.MethodPatch {
+				body = merge(value, body)
+			}
+			s.db[name] = body
+			s.save()
+			writeJSON(w, http.StatusOK, body)
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{})
+		}
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{})
+	}
+}
+
+// serveItem handles a single item of a collection
+func (s *Server) serveItem(w http.ResponseWriter, req *http.Request, method, name, id string) {
+	if method == http.MethodGet {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	} else {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	items, ok := s.db[name].([]interface{})
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{})
+		return
+	}
+	index := findByID(items, id)
+	if index < 0 {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{})
+		return
+	}
+	item := items[index].(map[string]interface{})
+
+	switch method {
+	case http.MethodGet:
+		query := req.URL.Query()
+		writeJSON(w, http.StatusOK, s.withRelations(item, name, query["_embed"], query["_expand"]))
+	case http.MethodPut, http.MethodPatch:
+		body, ok := readObject(w, req)
+		if !ok {
+			return
+		}
+		if method == http.MethodPatch {
+			body = merge(item, body)
+		}
+		// The id of an item never changes
+		body["id"] = item["id"]
+		items[index] = body
+		s.save()
+		writeJSON(w, http.StatusOK, body)
+	case http.MethodDelete:
+		s.db[name] = append(items[:index:index], items[index+1:]...)
+		s.removeDependents(name, id)
+		s.save()
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{})
+	}
+}
+
+// serveNested handles the children of an item, e.g. /posts/1/comments lists
+// the comments with postId 1
+func (s *Server) serveNested(w http.ResponseWriter, req *http.Request, method, parent, id, name string) {
+	if method == http.MethodGet {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	} else {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	parents, ok := s.db[parent].([]interface{})
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{})
+		return
+	}
+	index := findByID(parents, id)
+	items, ok := s.db[name].([]interface{})
+	if index < 0 || !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{})
+		return
+	}
+	foreignKey := singular(parent) + "Id"
+	parentID := parents[index].(map[string]interface{})["id"]
+
+	switch method {
+	case http.MethodGet:
+		children := []interface{}{}
+		for _, item := range items {
+			if object, ok := item.(map[string]interface{}); ok && equal(object[foreignKey], idString(parentID)) {
+				children = append(children, item)
+			}
+		}
+		s.list(w, req, name, children)
+	case http.MethodPost:
+		s.create(w, req, name, map[string]interface{}{foreignKey: parentID})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{})
+	}
+}
+
+// create adds the request body to the collection, with an id when it has none
+func (s *Server) create(w http.ResponseWriter, req *http.Request, name string, fields map[string]interface{}) {
+	body, ok := readObject(w, req)
+	if !ok {
+		return
+	}
+	for key, value := range fields {
+		body[key] = value
+	}
+
+	all := s.db[name].([]interface{})
+	if id, ok := body["id"]; ok && id != nil {
+		if findByID(all, idString(id)) >= 0 {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{"error": fmt.Sprintf("duplicate id %s", idString(id))})
+			return
+		}
+	} else {
+		body["id"] = newID(all)
+	}
+
+	s.db[name] = append(all, body)
+	s.save()
+	writeJSON(w, http.StatusCreated, body)
+}
+
+// removeDependents deletes the items of other collections that refer to a
+// deleted item through <singular>Id, as json-server does
+func (s *Server) removeDependents(name, id string) {
+	foreignKey := singular(name) + "Id"
+	for collection, value := range s.db {
+		items, ok := value.([]interface{})
+		if !ok || collection == name {
+			continue
+		}
+		kept := items[:0:0]
+		for _, item := range items {
+			if object, ok := item.(map[string]interface{}); ok && equal(object[foreignKey], id) {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		if len(kept) != len(items) {
+			s.db[collection] = kept
+		}
+	}
+}
+
+// newID returns the next id of a collection: one more than the highest
+// numeric id, or a random string when the collection uses string ids
+func newID(items []interface{}) interface{} {
+	if len(items) == 0 {
+		return json.Number("1")
+	}
+
+	var highest int64
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		n, ok := object["id"].(json.Number)
+		if !ok {
+			return randomID()
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return randomID()
+		}
+		if i > highest {
+			highest = i
+		}
+	}
+	return json.Number(fmt.Sprint(highest + 1))
+}
+
+// randomID returns a 7 character id like the nanoid ids of json-server
+func randomID() string {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_-"
+	b := make([]byte, 7)
+	for i := range b {
+		b[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// findByID returns the index of the item with the id, or -1
+func findByID(items []interface{}, id string) int {
+	for i, item := range items {
+		if object, ok := item.(map[string]interface{}); ok && equal(object["id"], id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// merge returns the shallow merge of patch into object
+func merge(object, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(object)+len(patch))
+	for key, value := range object {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		merged[key] = value
+	}
+	return merged
+}
+
+// readObject decodes a JSON object from the request body
+func readObject(w http.ResponseWriter, req *http.Request) (map[string]interface{}, bool) {
+	dec := json.NewDecoder(req.Body)
+	dec.UseNumber()
+	var body map[string]interface{}
+	if err := dec.Decode(&body); err != nil || body == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "the request body must be a JSON object"})
+		return nil, false
+	}
+	return body, true
+}
+
+// writeJSON writes v as indented JSON like json-server
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,236 @@
+package jsonserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDB = `{
+  "posts": [
+    {"id": 1, "title": "json-server", "author": {"name": "typicode"}, "views": 100},
+    {"id": 2, "title": "Kubernetes operators", "author": {"name": "alice"}, "views": 20},
+    {"id": 3, "title": "Go modules", "author": {"name": "bob"}, "views": 55}
+  ],
+  "comments": [
+    {"id": 1, "body": "nice", "postId": 1},
+    {"id": 2, "body": "great", "postId": 1},
+    {"id": 3, "body": "ok", "postId": 2}
+  ],
+  "profile": {"name": "typicode"}
+}`
+
+// newTestServer writes testDB to a temporary db.json and serves it
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db.json")
+	if err := os.WriteFile(path, []byte(testDB), 0o644); err != nil {
+		t.Fatalf("failed to write db.json: %v", err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load db.json: %v", err)
+	}
+	return s, path
+}
+
+// do sends a request to the server and decodes the JSON response
+func do(t *testing.T, s *Server, method, target, body string) (*httptest.ResponseRecorder, interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	var v interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("%s %s returned invalid JSON %q: %v", method, target, rec.Body.String(), err)
+	}
+	return rec, v
+}
+
+// ids returns the ids of a list response
+func ids(v interface{}) []float64 {
+	var out []float64
+	for _, item := range v.([]interface{}) {
+		out = append(out, item.(map[string]interface{})["id"].(float64))
+	}
+	return out
+}
+
+func equalIDs(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestServer_Queries(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		target string
+		want   []float64
+	}{
+		{"/posts", []float64{1, 2, 3}},
+		{"/posts?id=1&id=3", []float64{1, 3}},
+		{"/posts?author.name=alice", []float64{2}},
+		{"/posts?views_gte=50", []float64{1, 3}},
+		{"/posts?views_lte=50&views_ne=20", []float64{}},
+		{"/posts?title_like=^k", []float64{2}},
+		{"/posts?q=MODULES", []float64{3}},
+		{"/posts?_sort=views&_order=desc", []float64{1, 3, 2}},
+		{"/posts?_sort=title", []float64{3, 2, 1}},
+		{"/posts?_start=1&_end=3", []float64{2, 3}},
+		{"/posts?_start=1&_limit=1", []float64{2}},
+		{"/posts/1/comments", []float64{1, 2}},
+	}
+	for _, tt := range tests {
+		rec, v := do(t, s, http.MethodGet, tt.target, "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", tt.target, rec.Code)
+			continue
+		}
+		if got := ids(v); !equalIDs(got, tt.want) {
+			t.Errorf("GET %s: expected ids %v, got %v", tt.target, tt.want, got)
+		}
+	}
+}
+
+func TestServer_Pagination(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	rec, v := do(t, s, http.MethodGet, "/posts?_page=2&_limit=2", "")
+	if got := ids(v); !equalIDs(got, []float64{3}) {
+		t.Errorf("expected the second page to hold post 3, got %v", got)
+	}
+	if rec.Header().Get("X-Total-Count") != "3" {
+		t.Errorf("expected X-Total-Count 3, got %q", rec.Header().Get("X-Total-Count"))
+	}
+	link := rec.Header().Get("Link")
+	if !strings.Contains(link, `_page=1>; rel="prev"`) || !strings.Contains(link, `_page=2>; rel="last"`) || strings.Contains(link, `rel="next"`) {
+		t.Errorf("unexpected Link header %q", link)
+	}
+}
+
+func TestServer_PaginationExtremeValues(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		target string
+		want   []float64
+	}{
+		{"/posts?_page=2&_limit=9223372036854775807", []float64{}},
+		{"/posts?_page=9223372036854775807&_limit=2", []float64{}},
+		{"/posts?_page=1&_limit=9223372036854775807", []float64{1, 2, 3}},
+		{"/posts?_start=1&_limit=9223372036854775807", []float64{2, 3}},
+	}
+	for _, tt := range tests {
+		rec, v := do(t, s, http.MethodGet, tt.target, "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", tt.target, rec.Code)
+			continue
+		}
+		if got := ids(v); !equalIDs(got, tt.want) {
+			t.Errorf("GET %s: expected ids %v, got %v", tt.target, tt.want, got)
+		}
+	}
+}
+
+func TestServer_Relations(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	_, v := do(t, s, http.MethodGet, "/posts/1?_embed=comments", "")
+	if comments := v.(map[string]interface{})["comments"].([]interface{}); len(comments) != 2 {
+		t.Errorf("expected 2 embedded comments, got %v", comments)
+	}
+
+	_, v = do(t, s, http.MethodGet, "/comments?_expand=post&postId=2", "")
+	post := v.([]interface{})[0].(map[string]interface{})["post"].(map[string]interface{})
+	if post["title"] != "Kubernetes operators" {
+		t.Errorf("expected the expanded post, got %v", post)
+	}
+
+	// Embedding returns copies, the stored data is unchanged
+	_, v = do(t, s, http.MethodGet, "/db", "")
+	if _, ok := v.(map[string]interface{})["posts"].([]interface{})[0].(map[string]interface{})["comments"]; ok {
+		t.Error("expected embedding not to modify the data")
+	}
+}
+
+func TestServer_Writes(t *testing.T) {
+	s, path := newTestServer(t)
+
+	rec, v := do(t, s, http.MethodPost, "/posts", `{"title": "new"}`)
+	if rec.Code != http.StatusCreated || v.(map[string]interface{})["id"] != float64(4) {
+		t.Errorf("expected post 4 to be created, got %d %v", rec.Code, v)
+	}
+
+	rec, _ = do(t, s, http.MethodPost, "/posts", `{"id": 4, "title": "duplicate"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected a duplicate id to be rejected, got %d", rec.Code)
+	}
+
+	_, v = do(t, s, http.MethodPost, "/posts/2/comments", `{"body": "nested"}`)
+	if v.(map[string]interface{})["postId"] != float64(2) {
+		t.Errorf("expected the nested comment to reference post 2, got %v", v)
+	}
+
+	_, v = do(t, s, http.MethodPatch, "/posts/2", `{"views": 21, "id": 99}`)
+	if item := v.(map[string]interface{}); item["views"] != float64(21) || item["title"] != "Kubernetes operators" || item["id"] != float64(2) {
+		t.Errorf("expected PATCH to merge and keep the id, got %v", item)
+	}
+
+	_, v = do(t, s, http.MethodPut, "/posts/2", `{"title": "replaced"}`)
+	if item := v.(map[string]interface{}); item["views"] != nil || item["id"] != float64(2) {
+		t.Errorf("expected PUT to replace the item, got %v", item)
+	}
+
+	_, v = do(t, s, http.MethodPatch, "/profile", `{"email": "t@example.com"}`)
+	if profile := v.(map[string]interface{}); profile["name"] != "typicode" || profile["email"] != "t@example.com" {
+		t.Errorf("expected PATCH of the singular resource to merge, got %v", profile)
+	}
+
+	// Deleting a post removes its comments
+	rec, _ = do(t, s, http.MethodDelete, "/posts/1", "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected DELETE to succeed, got %d", rec.Code)
+	}
+	rec, _ = do(t, s, http.MethodGet, "/posts/1", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected the deleted post to be gone, got %d", rec.Code)
+	}
+	_, v = do(t, s, http.MethodGet, "/comments", "")
+	if got := ids(v); !equalIDs(got, []float64{3, 4}) {
+		t.Errorf("expected the comments of post 1 to be deleted, got %v", got)
+	}
+
+	// Changes are written back to db.json
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to reload db.json: %v", err)
+	}
+	_, v = do(t, reloaded, http.MethodGet, "/posts", "")
+	if got := ids(v); !equalIDs(got, []float64{2, 3, 4}) {
+		t.Errorf("expected the changes in db.json, got %v", got)
+	}
+}
+
+func TestServer_NotFound(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for _, target := range []string{"/unknown", "/posts/42", "/posts/42/comments", "/a/b/c/d"} {
+		rec, _ := do(t, s, http.MethodGet, target, "")
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404, got %d", target, rec.Code)
+		}
+	}
+}